@@ -0,0 +1,78 @@
+package extsort
+
+import (
+	"bufio"
+	"io"
+)
+
+// Decoder reads records one at a time. Decode returns io.EOF once the input
+// is exhausted.
+type Decoder[T any] interface {
+	Decode() (T, error)
+}
+
+// Encoder writes records one at a time. Flush is called once all the records
+// of an output have been encoded.
+type Encoder[T any] interface {
+	Encode(record T) error
+	Flush() error
+}
+
+// Codec is used to spill sorted runs to temporary files and read them back.
+// Size estimates the memory held by a record and is used to bound the size of
+// the runs sorted in memory.
+type Codec[T any] interface {
+	NewDecoder(r io.Reader) Decoder[T]
+	NewEncoder(w io.Writer) Encoder[T]
+	Size(record T) int
+}
+
+// LineCodec decodes and encodes newline delimited text. Records do not keep
+// their trailing newline.
+type LineCodec struct{}
+
+// stringOverhead approximates the memory held by a string header and the
+// slice slot referencing it.
+const stringOverhead = 32
+
+func (LineCodec) NewDecoder(r io.Reader) Decoder[string] {
+	return &lineDecoder{reader: bufio.NewReader(r)}
+}
+
+func (LineCodec) NewEncoder(w io.Writer) Encoder[string] {
+	return &lineEncoder{writer: bufio.NewWriter(w)}
+}
+
+func (LineCodec) Size(record string) int {
+	return len(record) + stringOverhead
+}
+
+type lineDecoder struct {
+	reader *bufio.Reader
+}
+
+func (d *lineDecoder) Decode() (string, error) {
+	line, err := d.reader.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		return line, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return line[:len(line)-1], nil
+}
+
+type lineEncoder struct {
+	writer *bufio.Writer
+}
+
+func (e *lineEncoder) Encode(record string) error {
+	if _, err := e.writer.WriteString(record); err != nil {
+		return err
+	}
+	return e.writer.WriteByte('\n')
+}
+
+func (e *lineEncoder) Flush() error {
+	return e.writer.Flush()
+}
@@ -0,0 +1,269 @@
+// Package extsort sorts data sets larger than memory. Records are read in
+// bounded runs which are sorted in memory and spilled to temporary files,
+// then the runs are merged with a heap based k-way merge.
+package extsort
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+const (
+	// DefaultMemoryLimit is used when Config.MemoryLimit is not set.
+	DefaultMemoryLimit = 64 << 20
+	// DefaultFanIn is used when Config.FanIn is not set.
+	DefaultFanIn = 16
+)
+
+type Config struct {
+	// MemoryLimit bounds the estimated size, in bytes, of the records sorted
+	// in memory at once.
+	MemoryLimit int64
+	// FanIn is the maximum number of runs merged at once. When there are
+	// more runs, intermediate merge passes are done first.
+	FanIn int
+	// TempDir is the directory the runs are spilled to. The default
+	// directory for temporary files is used when empty.
+	TempDir string
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.MemoryLimit <= 0 {
+		cfg.MemoryLimit = DefaultMemoryLimit
+	}
+	if cfg.FanIn <= 0 {
+		cfg.FanIn = DefaultFanIn
+	}
+	if cfg.FanIn < 2 {
+		cfg.FanIn = 2
+	}
+	return cfg
+}
+
+// Sort reads every record from in and writes them to out ordered by less.
+// Records which are equal keep their input order. The temporary files are
+// removed before Sort returns, whether it succeeds or not.
+func Sort[T any](in Decoder[T], out Encoder[T], codec Codec[T], less func(T, T) bool, cfg Config) error {
+	s := &sorter[T]{codec: codec, less: less, cfg: cfg.withDefaults()}
+	return s.sort(in, out)
+}
+
+// SortLines sorts the lines of r lexically and writes them to w.
+func SortLines(r io.Reader, w io.Writer, cfg Config) error {
+	var codec LineCodec
+	return Sort[string](codec.NewDecoder(r), codec.NewEncoder(w), codec, func(a, b string) bool {
+		return a < b
+	}, cfg)
+}
+
+type sorter[T any] struct {
+	codec Codec[T]
+	less  func(T, T) bool
+	cfg   Config
+	dir   string
+}
+
+func (s *sorter[T]) sort(in Decoder[T], out Encoder[T]) error {
+	var (
+		runs []string
+		err  error
+	)
+
+	buffer := make([]T, 0)
+	for eof := false; !eof; {
+		buffer, eof, err = s.readRun(in, buffer[:0])
+		if err != nil {
+			return err
+		}
+
+		// Everything fits in memory, there is no need to spill.
+		if eof && len(runs) == 0 {
+			return writeAll(out, buffer)
+		}
+
+		if len(buffer) == 0 {
+			continue
+		}
+
+		if s.dir == "" {
+			if s.dir, err = os.MkdirTemp(s.cfg.TempDir, "extsort-"); err != nil {
+				return fmt.Errorf("create temporary directory: %w", err)
+			}
+			defer os.RemoveAll(s.dir)
+		}
+
+		run, err := s.spill(buffer)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, run)
+	}
+
+	for len(runs) > s.cfg.FanIn {
+		if runs, err = s.mergePass(runs); err != nil {
+			return err
+		}
+	}
+	return s.merge(runs, out)
+}
+
+// readRun decodes records until their estimated size exceeds the memory
+// limit, then sorts them.
+func (s *sorter[T]) readRun(in Decoder[T], buffer []T) ([]T, bool, error) {
+	var size int64
+	eof := false
+	for size < s.cfg.MemoryLimit {
+		record, err := in.Decode()
+		if err == io.EOF {
+			eof = true
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("decode input: %w", err)
+		}
+		buffer = append(buffer, record)
+		size += int64(s.codec.Size(record))
+	}
+
+	sort.SliceStable(buffer, func(i, j int) bool {
+		return s.less(buffer[i], buffer[j])
+	})
+	return buffer, eof, nil
+}
+
+// spill writes a sorted run to a new temporary file.
+func (s *sorter[T]) spill(records []T) (string, error) {
+	file, err := os.CreateTemp(s.dir, "run-")
+	if err != nil {
+		return "", fmt.Errorf("create run: %w", err)
+	}
+	err = writeAll(s.codec.NewEncoder(file), records)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("spill run: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// mergePass merges the runs in groups of FanIn into fewer, longer runs.
+func (s *sorter[T]) mergePass(runs []string) ([]string, error) {
+	merged := make([]string, 0, (len(runs)+s.cfg.FanIn-1)/s.cfg.FanIn)
+	for start := 0; start < len(runs); start += s.cfg.FanIn {
+		end := start + s.cfg.FanIn
+		if end > len(runs) {
+			end = len(runs)
+		}
+
+		file, err := os.CreateTemp(s.dir, "run-")
+		if err != nil {
+			return nil, fmt.Errorf("create run: %w", err)
+		}
+		err = s.merge(runs[start:end], s.codec.NewEncoder(file))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, run := range runs[start:end] {
+			_ = os.Remove(run)
+		}
+		merged = append(merged, file.Name())
+	}
+	return merged, nil
+}
+
+// merge does a k-way merge of the runs into out.
+func (s *sorter[T]) merge(runs []string, out Encoder[T]) error {
+	cursors := heap.New[int, *cursor[T]](&mergeOrder[T]{less: s.less})
+	for i, run := range runs {
+		file, err := os.Open(run)
+		if err != nil {
+			return fmt.Errorf("open run: %w", err)
+		}
+		defer file.Close()
+
+		c := &cursor[T]{run: i, decoder: s.codec.NewDecoder(file)}
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			cursors.Add(c)
+		}
+	}
+
+	for cursors.Len() > 0 {
+		c, err := cursors.Pop()
+		if err != nil {
+			return err
+		}
+		if err = out.Encode(c.record); err != nil {
+			return fmt.Errorf("encode output: %w", err)
+		}
+
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			cursors.Add(c)
+		}
+	}
+	return out.Flush()
+}
+
+func writeAll[T any](out Encoder[T], records []T) error {
+	for _, record := range records {
+		if err := out.Encode(record); err != nil {
+			return fmt.Errorf("encode output: %w", err)
+		}
+	}
+	return out.Flush()
+}
+
+// cursor is the head of a run during a merge.
+type cursor[T any] struct {
+	run     int
+	record  T
+	decoder Decoder[T]
+}
+
+func (c *cursor[T]) next() (bool, error) {
+	record, err := c.decoder.Decode()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("decode run: %w", err)
+	}
+	c.record = record
+	return true, nil
+}
+
+// mergeOrder orders the cursors by their current record. Ties are broken by
+// the run index so that the merge is stable.
+type mergeOrder[T any] struct {
+	less func(T, T) bool
+}
+
+func (order *mergeOrder[T]) FormStoreKey(c *cursor[T]) int {
+	return c.run
+}
+
+func (order *mergeOrder[T]) Less(left, right *cursor[T]) bool {
+	if order.less(left.record, right.record) {
+		return true
+	}
+	if order.less(right.record, left.record) {
+		return false
+	}
+	return left.run < right.run
+}
@@ -0,0 +1,163 @@
+package extsort
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func randomLines(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%08d", r.Intn(n*10))
+	}
+	return lines
+}
+
+func TestSortLines(t *testing.T) {
+	lines := randomLines(1000)
+	for name, cfg := range map[string]Config{
+		"in memory":   {},
+		"single pass": {MemoryLimit: 4000, FanIn: 100},
+		"multi pass":  {MemoryLimit: 1000, FanIn: 2},
+	} {
+		cfg.TempDir = t.TempDir()
+		var out strings.Builder
+		if err := SortLines(strings.NewReader(strings.Join(lines, "\n")), &out, cfg); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		expected := append([]string(nil), lines...)
+		sort.Strings(expected)
+		if e, a := strings.Join(expected, "\n")+"\n", out.String(); e != a {
+			t.Errorf("%s: output is not sorted", name)
+		}
+
+		if entries, _ := os.ReadDir(cfg.TempDir); len(entries) != 0 {
+			t.Errorf("%s: expected temporary files to be removed, got %d entries", name, len(entries))
+		}
+	}
+}
+
+type record struct {
+	key   int
+	order int
+}
+
+type recordCodec struct{}
+
+func (recordCodec) NewDecoder(r io.Reader) Decoder[record] {
+	return &recordDecoder{reader: r}
+}
+
+func (recordCodec) NewEncoder(w io.Writer) Encoder[record] {
+	return &recordEncoder{writer: w}
+}
+
+func (recordCodec) Size(record) int {
+	return 16
+}
+
+type recordDecoder struct {
+	reader io.Reader
+}
+
+func (d *recordDecoder) Decode() (record, error) {
+	var r record
+	_, err := fmt.Fscanln(d.reader, &r.key, &r.order)
+	return r, err
+}
+
+type recordEncoder struct {
+	writer io.Writer
+}
+
+func (e *recordEncoder) Encode(r record) error {
+	_, err := fmt.Fprintln(e.writer, r.key, r.order)
+	return err
+}
+
+func (e *recordEncoder) Flush() error {
+	return nil
+}
+
+type sliceDecoder struct {
+	records []record
+	err     error
+}
+
+func (d *sliceDecoder) Decode() (record, error) {
+	if len(d.records) == 0 {
+		if d.err != nil {
+			return record{}, d.err
+		}
+		return record{}, io.EOF
+	}
+	r := d.records[0]
+	d.records = d.records[1:]
+	return r, nil
+}
+
+type sliceEncoder struct {
+	records []record
+}
+
+func (e *sliceEncoder) Encode(r record) error {
+	e.records = append(e.records, r)
+	return nil
+}
+
+func (e *sliceEncoder) Flush() error {
+	return nil
+}
+
+func TestSort_Stable(t *testing.T) {
+	records := make([]record, 500)
+	for i := range records {
+		records[i] = record{key: i % 7, order: i}
+	}
+
+	out := &sliceEncoder{}
+	err := Sort[record](&sliceDecoder{records: records}, out, recordCodec{}, func(a, b record) bool {
+		return a.key < b.key
+	}, Config{MemoryLimit: 160, FanIn: 3, TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(out.records) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(out.records))
+	}
+	for i := 1; i < len(out.records); i++ {
+		prev, cur := out.records[i-1], out.records[i]
+		if prev.key > cur.key || (prev.key == cur.key && prev.order > cur.order) {
+			t.Fatalf("got %v after %v", cur, prev)
+		}
+	}
+}
+
+func TestSort_CleanupOnError(t *testing.T) {
+	records := make([]record, 100)
+	for i := range records {
+		records[i] = record{key: len(records) - i, order: i}
+	}
+	decodeErr := errors.New("broken input")
+
+	dir := t.TempDir()
+	err := Sort[record](&sliceDecoder{records: records, err: decodeErr}, &sliceEncoder{}, recordCodec{}, func(a, b record) bool {
+		return a.key < b.key
+	}, Config{MemoryLimit: 160, TempDir: dir})
+	if !errors.Is(err, decodeErr) {
+		t.Fatalf("expected decode error, got %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected temporary files to be removed, got %d entries", len(entries))
+	}
+}
@@ -53,6 +53,35 @@ func (heap *concurrentHeap[VALUE]) Pop() (VALUE, error) {
 	return Pop[VALUE](heap.data)
 }
 
+// PopN removes and returns up to n items from the head of the heap, in
+// priority order, under a single lock acquisition.
+func (heap *concurrentHeap[VALUE]) PopN(n int) []VALUE {
+	heap.lock.Lock()
+	defer heap.lock.Unlock()
+	list := make([]VALUE, 0, minInt(n, heap.data.Len()))
+	for len(list) < n {
+		value, err := Pop[VALUE](heap.data)
+		if err != nil {
+			break
+		}
+		list = append(list, value)
+	}
+	return list
+}
+
+// PeekN returns up to n items from the head of the heap, in priority order,
+// without removing them.
+func (heap *concurrentHeap[VALUE]) PeekN(n int) []VALUE {
+	heap.lock.RLock()
+	defer heap.lock.RUnlock()
+	order := peekN[VALUE](heap.data, n)
+	list := make([]VALUE, 0, len(order))
+	for _, i := range order {
+		list = append(list, heap.data.at(i))
+	}
+	return list
+}
+
 // Get returns the requested item, or sets exists=false.
 func (heap *concurrentHeap[VALUE]) Get(value VALUE) (VALUE, bool) {
 	heap.lock.RLock()
@@ -84,6 +113,17 @@ func (heap *concurrentHeap[VALUE]) Len() int {
 	return len(heap.data.queue)
 }
 
+// Snapshot returns the items of the heap ordered by their position.
+func (heap *concurrentHeap[VALUE]) Snapshot() []Node[VALUE] {
+	heap.lock.RLock()
+	defer heap.lock.RUnlock()
+	nodes := make([]Node[VALUE], 0, len(heap.data.queue))
+	for i, key := range heap.data.queue {
+		nodes = append(nodes, Node[VALUE]{Index: i, Key: key, Value: heap.data.at(i)})
+	}
+	return nodes
+}
+
 type concurrentData[VALUE any] struct {
 	items    cmap.ConcurrentMap[*heapItem[VALUE]]
 	queue    []string
@@ -156,6 +196,12 @@ func (h *concurrentData[VALUE]) Push(value VALUE) {
 	h.queue = append(h.queue, key)
 }
 
+// at returns the value stored at position i of the heap.
+func (h *concurrentData[VALUE]) at(i int) VALUE {
+	item, _ := h.items.Get(h.queue[i])
+	return item.value
+}
+
 // Peek is supposed to be called by heap.Peek only.
 func (h *concurrentData[VALUE]) Peek() (VALUE, error) {
 	var empty VALUE
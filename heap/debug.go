@@ -0,0 +1,84 @@
+package heap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Node describes an item of a heap together with its position in the
+// underlying array. The children of the node at Index i are at 2*i+1 and
+// 2*i+2.
+type Node[VALUE any] struct {
+	Index int
+	Key   string
+	Value VALUE
+}
+
+// Snapshotter is implemented by heaps which can expose their internal layout
+// for debugging.
+type Snapshotter[VALUE any] interface {
+	Snapshot() []Node[VALUE]
+}
+
+// Snapshot returns the nodes of the heap ordered by their position.
+func Snapshot[VALUE any](h Heap[VALUE]) ([]Node[VALUE], error) {
+	s, ok := h.(Snapshotter[VALUE])
+	if !ok {
+		return nil, fmt.Errorf("heap %T can not be snapshotted", h)
+	}
+	return s.Snapshot(), nil
+}
+
+// WriteDOT renders the nodes as a Graphviz DOT graph. Each node is labeled
+// with its index, key and the value as rendered by format; a nil format
+// falls back to fmt.Sprint.
+func WriteDOT[VALUE any](w io.Writer, nodes []Node[VALUE], format func(VALUE) string) error {
+	format = formatter(format)
+	var b strings.Builder
+	b.WriteString("digraph heap {\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, node := range nodes {
+		label := fmt.Sprintf("[%d] %s\n%s", node.Index, node.Key, format(node.Value))
+		fmt.Fprintf(&b, "\tn%d [label=%q];\n", node.Index, label)
+	}
+	for _, node := range nodes {
+		for _, child := range [2]int{2*node.Index + 1, 2*node.Index + 2} {
+			if child < len(nodes) {
+				fmt.Fprintf(&b, "\tn%d -> n%d;\n", node.Index, child)
+			}
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteTree renders the nodes as an indented text tree, one node per line,
+// children indented below their parent.
+func WriteTree[VALUE any](w io.Writer, nodes []Node[VALUE], format func(VALUE) string) error {
+	format = formatter(format)
+	var b strings.Builder
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if i >= len(nodes) {
+			return
+		}
+		node := nodes[i]
+		fmt.Fprintf(&b, "%s[%d] key=%s value=%s\n", strings.Repeat("  ", depth), node.Index, node.Key, format(node.Value))
+		walk(2*i+1, depth+1)
+		walk(2*i+2, depth+1)
+	}
+	walk(0, 0)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatter[VALUE any](format func(VALUE) string) func(VALUE) string {
+	if format != nil {
+		return format
+	}
+	return func(value VALUE) string {
+		return fmt.Sprint(value)
+	}
+}
@@ -73,6 +73,11 @@ func (h *data[_, VALUE]) Push(value VALUE) {
 	h.queue = append(h.queue, key)
 }
 
+// at returns the value stored at position i of the heap.
+func (h *data[_, VALUE]) at(i int) VALUE {
+	return h.items[h.queue[i]].value
+}
+
 // Peek is supposed to be called by heap.Peek only.
 func (h *data[_, VALUE]) Peek() (VALUE, error) {
 	if len(h.queue) > 0 {
@@ -118,6 +123,31 @@ func (heap *heap[KEY, VALUE]) Pop() (VALUE, error) {
 	return Pop[VALUE](heap.data)
 }
 
+// PopN removes and returns up to n items from the head of the heap, in
+// priority order.
+func (heap *heap[KEY, VALUE]) PopN(n int) []VALUE {
+	list := make([]VALUE, 0, minInt(n, heap.data.Len()))
+	for len(list) < n {
+		value, err := Pop[VALUE](heap.data)
+		if err != nil {
+			break
+		}
+		list = append(list, value)
+	}
+	return list
+}
+
+// PeekN returns up to n items from the head of the heap, in priority order,
+// without removing them.
+func (heap *heap[KEY, VALUE]) PeekN(n int) []VALUE {
+	order := peekN[VALUE](heap.data, n)
+	list := make([]VALUE, 0, len(order))
+	for _, i := range order {
+		list = append(list, heap.data.at(i))
+	}
+	return list
+}
+
 // Get returns the requested item, or sets exists=false.
 func (heap *heap[KEY, VALUE]) Get(value VALUE) (VALUE, bool) {
 	key := heap.data.priority.FormStoreKey(value)
@@ -143,6 +173,15 @@ func (heap *heap[KEY, VALUE]) Len() int {
 	return len(heap.data.queue)
 }
 
+// Snapshot returns the items of the heap ordered by their position.
+func (heap *heap[KEY, VALUE]) Snapshot() []Node[VALUE] {
+	nodes := make([]Node[VALUE], 0, len(heap.data.queue))
+	for i, key := range heap.data.queue {
+		nodes = append(nodes, Node[VALUE]{Index: i, Key: fmt.Sprint(key), Value: heap.data.items[key].value})
+	}
+	return nodes
+}
+
 // New returns a heap which can be used to queue up items to process.
 func New[KEY comparable, VALUE any](priority Constraint[KEY, VALUE]) Heap[VALUE] {
 	return newHeap[KEY, VALUE](priority)
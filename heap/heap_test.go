@@ -1,6 +1,8 @@
 package heap
 
 import (
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -327,3 +329,81 @@ func TestConcurrentHeap_List(t *testing.T) {
 		}
 	}
 }
+
+// TestHeap_PopNAndPeekN tests heap.PopN and heap.PeekN return items in
+// priority order.
+func TestHeap_PopNAndPeekN(t *testing.T) {
+	handler := priorityHandler{}
+	for name, h := range map[string]Heap[testHeapObject]{
+		"heap":       New[string, testHeapObject](&handler),
+		"concurrent": NewConcurrent[testHeapObject](&handler),
+	} {
+		for i := 50; i > 0; i-- {
+			h.Add(mkHeapObj(string([]rune{'a', rune(i)}), i))
+		}
+
+		if list := h.PeekN(0); len(list) != 0 {
+			t.Fatalf("%s: expected no item, got %d", name, len(list))
+		}
+		list := h.PeekN(10)
+		if len(list) != 10 || h.Len() != 50 {
+			t.Fatalf("%s: expected to peek 10 of 50 items, got %d of %d", name, len(list), h.Len())
+		}
+		for i, item := range list {
+			if item.val != i+1 {
+				t.Fatalf("%s: expected %d, got %d", name, i+1, item.val)
+			}
+		}
+
+		list = h.PopN(20)
+		if len(list) != 20 || h.Len() != 30 {
+			t.Fatalf("%s: expected to pop 20 of 50 items, got %d, %d left", name, len(list), h.Len())
+		}
+		for i, item := range list {
+			if item.val != i+1 {
+				t.Fatalf("%s: expected %d, got %d", name, i+1, item.val)
+			}
+		}
+
+		if list = h.PeekN(100); len(list) != 30 || list[0].val != 21 || list[29].val != 50 {
+			t.Fatalf("%s: unexpected peek of the remaining items: %v", name, list)
+		}
+		if list = h.PopN(100); len(list) != 30 || h.Len() != 0 {
+			t.Fatalf("%s: expected to pop the remaining 30 items, got %d", name, len(list))
+		}
+	}
+}
+
+// TestHeap_Dump tests the DOT and text tree renderings of a heap.
+func TestHeap_Dump(t *testing.T) {
+	handler := priorityHandler{}
+	h := New[string, testHeapObject](&handler)
+	h.Add(mkHeapObj("foo", 10))
+	h.Add(mkHeapObj("bar", 1))
+	h.Add(mkHeapObj("baz", 11))
+
+	nodes, err := Snapshot[testHeapObject](h)
+	if err != nil || len(nodes) != 3 || nodes[0].Key != "bar" {
+		t.Fatalf("unexpected snapshot %v, err: %v", nodes, err)
+	}
+	format := func(obj testHeapObject) string { return strconv.Itoa(obj.val) }
+
+	var tree strings.Builder
+	if err = WriteTree[testHeapObject](&tree, nodes, format); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "[0] key=bar value=1\n  [1] key=foo value=10\n  [2] key=baz value=11\n"
+	if tree.String() != expected {
+		t.Fatalf("expected tree %q, got %q", expected, tree.String())
+	}
+
+	var dot strings.Builder
+	if err = WriteDOT[testHeapObject](&dot, nodes, format); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, edge := range []string{"n0 -> n1;", "n0 -> n2;", `n0 [label="[0] bar\n1"];`} {
+		if !strings.Contains(dot.String(), edge) {
+			t.Errorf("expected %q in %q", edge, dot.String())
+		}
+	}
+}
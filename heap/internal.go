@@ -16,6 +16,8 @@ type Heap[V any] interface {
 	Delete(value V) error
 	Peek() (V, error)
 	Pop() (V, error)
+	PopN(n int) []V
+	PeekN(n int) []V
 	Get(value V) (V, bool)
 	List() []V
 	Len() int
@@ -77,6 +79,77 @@ func Fix[VALUE any](h Interface[VALUE], i int) {
 	}
 }
 
+// candidates is a heap of positions in another heap. It is used to walk the
+// top of a heap in priority order without modifying it.
+type candidates[VALUE any] struct {
+	source  Interface[VALUE]
+	indexes []int
+}
+
+func (c *candidates[_]) Len() int {
+	return len(c.indexes)
+}
+
+func (c *candidates[_]) Less(i, j int) bool {
+	return c.source.Less(c.indexes[i], c.indexes[j])
+}
+
+func (c *candidates[_]) Swap(i, j int) {
+	c.indexes[i], c.indexes[j] = c.indexes[j], c.indexes[i]
+}
+
+func (c *candidates[_]) Push(x int) {
+	c.indexes = append(c.indexes, x)
+}
+
+func (c *candidates[_]) Pop() (int, error) {
+	if len(c.indexes) == 0 {
+		return 0, fmt.Errorf("pop a empty heap")
+	}
+	x := c.indexes[len(c.indexes)-1]
+	c.indexes = c.indexes[0 : len(c.indexes)-1]
+	return x, nil
+}
+
+// peekN returns the positions of the first n items of the heap in priority
+// order. The heap is left untouched.
+func peekN[VALUE any](heap Interface[VALUE], n int) []int {
+	size := heap.Len()
+	if n > size {
+		n = size
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	c := &candidates[VALUE]{source: heap, indexes: make([]int, 0, n)}
+	Push[int](c, 0)
+	order := make([]int, 0, n)
+	for len(order) < n {
+		i, err := Pop[int](c)
+		if err != nil {
+			break
+		}
+		order = append(order, i)
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < size {
+				Push[int](c, child)
+			}
+		}
+	}
+	return order
+}
+
+func minInt(a, b int) int {
+	if a > b {
+		a = b
+	}
+	if a < 0 {
+		return 0
+	}
+	return a
+}
+
 func heapifyUp[VALUE any](heap Interface[VALUE], i int) {
 	for {
 		parent := (i - 1) / 2
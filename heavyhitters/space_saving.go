@@ -0,0 +1,122 @@
+// Package heavyhitters tracks the approximate most frequent keys of a stream
+// with bounded memory.
+package heavyhitters
+
+import (
+	"sort"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+// Counter is the estimated frequency of a monitored key. Count never
+// underestimates the true frequency and overestimates it by at most Error.
+type Counter[K comparable] struct {
+	Key   K
+	Count uint64
+	Error uint64
+}
+
+// Guaranteed returns the lower bound of the frequency of the key.
+func (c Counter[K]) Guaranteed() uint64 {
+	return c.Count - c.Error
+}
+
+type countOrder[K comparable] struct{}
+
+func (countOrder[K]) FormStoreKey(c *Counter[K]) K {
+	return c.Key
+}
+
+func (countOrder[K]) Less(left, right *Counter[K]) bool {
+	return left.Count < right.Count
+}
+
+// SpaceSaving implements the Space-Saving algorithm of Metwally, Agrawal and
+// El Abbadi. It monitors at most capacity keys in a min-heap of counters;
+// an unmonitored key replaces the smallest counter and inherits its count as
+// its error. Every key occurring more than Total()/capacity times is
+// guaranteed to be monitored.
+//
+// SpaceSaving is not safe for concurrent use.
+type SpaceSaving[K comparable] struct {
+	capacity int
+	total    uint64
+	counters heap.Heap[*Counter[K]]
+}
+
+func New[K comparable](capacity int) *SpaceSaving[K] {
+	return &SpaceSaving[K]{
+		capacity: capacity,
+		counters: heap.New[K, *Counter[K]](countOrder[K]{}),
+	}
+}
+
+// Observe records count occurrences of key.
+func (s *SpaceSaving[K]) Observe(key K, count uint64) {
+	if count == 0 || s.capacity <= 0 {
+		return
+	}
+	s.total += count
+
+	if counter, ok := s.counters.Get(&Counter[K]{Key: key}); ok {
+		// Adding an existing key updates its counter in place and fixes
+		// its position in the heap.
+		updated := *counter
+		updated.Count += count
+		s.counters.Add(&updated)
+		return
+	}
+
+	if s.counters.Len() < s.capacity {
+		s.counters.Add(&Counter[K]{Key: key, Count: count})
+		return
+	}
+
+	smallest, err := s.counters.Pop()
+	if err != nil {
+		return
+	}
+	s.counters.Add(&Counter[K]{Key: key, Count: smallest.Count + count, Error: smallest.Count})
+}
+
+// TopK returns up to k counters with the largest counts, largest first.
+func (s *SpaceSaving[K]) TopK(k int) []Counter[K] {
+	counters := s.counters.List()
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Count != counters[j].Count {
+			return counters[i].Count > counters[j].Count
+		}
+		return counters[i].Guaranteed() > counters[j].Guaranteed()
+	})
+	if k > len(counters) {
+		k = len(counters)
+	}
+	if k < 0 {
+		k = 0
+	}
+
+	top := make([]Counter[K], 0, k)
+	for _, counter := range counters[:k] {
+		top = append(top, *counter)
+	}
+	return top
+}
+
+// Get returns the counter of key if it is monitored.
+func (s *SpaceSaving[K]) Get(key K) (Counter[K], bool) {
+	counter, ok := s.counters.Get(&Counter[K]{Key: key})
+	if !ok {
+		return Counter[K]{}, false
+	}
+	return *counter, true
+}
+
+// Total returns the sum of all observed counts.
+func (s *SpaceSaving[K]) Total() uint64 {
+	return s.total
+}
+
+// Len returns the number of monitored keys.
+func (s *SpaceSaving[K]) Len() int {
+	return s.counters.Len()
+}
@@ -0,0 +1,75 @@
+package heavyhitters
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSpaceSaving_Exact(t *testing.T) {
+	s := New[string](3)
+	s.Observe("foo", 5)
+	s.Observe("bar", 1)
+	s.Observe("baz", 3)
+	s.Observe("bar", 4)
+
+	top := s.TopK(2)
+	if len(top) != 2 {
+		t.Fatalf("expected 2 counters, got %d", len(top))
+	}
+	for i, e := range []Counter[string]{{Key: "foo", Count: 5}, {Key: "bar", Count: 5}} {
+		if top[i].Count != e.Count || top[i].Error != 0 {
+			t.Errorf("expected %v, got %v", e, top[i])
+		}
+	}
+	if s.Total() != 13 || s.Len() != 3 {
+		t.Fatalf("expected total 13 over 3 keys, got %d over %d", s.Total(), s.Len())
+	}
+}
+
+func TestSpaceSaving_Eviction(t *testing.T) {
+	s := New[string](2)
+	s.Observe("foo", 10)
+	s.Observe("bar", 2)
+	s.Observe("baz", 1) // Replaces "bar".
+
+	if _, ok := s.Get("bar"); ok {
+		t.Fatalf("expected bar to be evicted")
+	}
+	counter, ok := s.Get("baz")
+	if !ok || counter.Count != 3 || counter.Error != 2 || counter.Guaranteed() != 1 {
+		t.Fatalf("unexpected counter %v", counter)
+	}
+}
+
+func TestSpaceSaving_Bounds(t *testing.T) {
+	const capacity = 20
+	r := rand.New(rand.NewSource(1))
+	s := New[string](capacity)
+	exact := make(map[string]uint64)
+	for i := 0; i < 10000; i++ {
+		// A few heavy keys over a long tail of light ones.
+		key := fmt.Sprintf("light_%d", r.Intn(1000))
+		if r.Intn(2) == 0 {
+			key = fmt.Sprintf("heavy_%d", r.Intn(5))
+		}
+		exact[key]++
+		s.Observe(key, 1)
+	}
+
+	for key, count := range exact {
+		counter, ok := s.Get(key)
+		if count > s.Total()/capacity && !ok {
+			t.Errorf("expected frequent key %s to be monitored", key)
+		}
+		if ok && (counter.Count < count || counter.Guaranteed() > count) {
+			t.Errorf("frequency %d of %s is out of bounds %v", count, key, counter)
+		}
+	}
+
+	for _, counter := range s.TopK(5) {
+		if counter.Key[:5] != "heavy" {
+			t.Errorf("unexpected top key %v", counter)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+// PriorityConstraint is a HeapConstraint exposing the priority of the items
+// as a number, which aging requires. Items with a lower priority pop first,
+// so Priority must agree with Less.
+type PriorityConstraint[V any] interface {
+	HeapConstraint[V]
+	Priority(value V) float64
+}
+
+// AgingPolicy lowers the priority of the items the longer they wait, so that
+// a steady stream of urgent items can not starve the others.
+type AgingPolicy struct {
+	boost    float64
+	interval time.Duration
+	step     bool
+}
+
+// LinearAging lowers the priority of an item continuously, by boost every
+// interval it waits. The interval must be positive.
+func LinearAging(boost float64, interval time.Duration) AgingPolicy {
+	return AgingPolicy{boost: boost, interval: interval}
+}
+
+// StepAging lowers the priority of an item by boost once per full interval
+// it waits. The interval must be positive.
+func StepAging(boost float64, interval time.Duration) AgingPolicy {
+	return AgingPolicy{boost: boost, interval: interval, step: true}
+}
+
+// WithAging ages the priority of the items. Updating an item keeps the age it
+// accumulated. The items do not age when the constraint of the queue is not a
+// PriorityConstraint or the interval of policy is not positive; use
+// NewAgingQueue to be told about it.
+func WithAging(policy AgingPolicy) Option {
+	return func(cfg *options) {
+		if policy.interval <= 0 {
+			cfg.aging = nil
+			return
+		}
+		cfg.aging = &policy
+	}
+}
+
+// NewAgingQueue returns a BlockQueue aging the priority of its items by
+// policy. It fails with ErrInvalidAging when the interval of policy is not
+// positive.
+func NewAgingQueue[V any](constraint PriorityConstraint[V], policy AgingPolicy, opts ...Option) (BlockQueue[V], error) {
+	if policy.interval <= 0 {
+		return nil, ErrInvalidAging
+	}
+	return newBlockQueue[V](constraint, append(opts, WithAging(policy))...), nil
+}
+
+type agingScore[V any] struct {
+	value      V
+	enqueuedAt time.Time
+	priority   float64
+	// score orders the items, lower first. Linear aging uses a score which
+	// does not depend on the current time, step aging lowers it lazily.
+	score float64
+	steps int
+}
+
+type agingStep struct {
+	key string
+	at  time.Time
+}
+
+type agingStepOrder struct{}
+
+func (agingStepOrder) FormStoreKey(step *agingStep) string {
+	return step.key
+}
+
+func (agingStepOrder) Less(left, right *agingStep) bool {
+	return left.at.Before(right.at)
+}
+
+// agingHeap orders the items by their aged priority.
+//
+// With linear aging the priority at time t is p - rate*(t-enqueuedAt), so
+// comparing p + rate*enqueuedAt orders the items the same way at any time and
+// the heap never needs to be fixed as time passes. With step aging the items
+// are fixed one by one, when they cross a step, before each read of the head.
+type agingHeap[V any] struct {
+	// lock guards scores, which Less reads while the inner heap is used.
+	lock       sync.Mutex
+	inner      heap.Heap[V]
+	constraint PriorityConstraint[V]
+	policy     AgingPolicy
+	scores     map[string]*agingScore[V]
+	steps      heap.Heap[*agingStep]
+	epoch      time.Time
+	now        func() time.Time
+}
+
+func newAgingHeap[V any](constraint PriorityConstraint[V], policy AgingPolicy) *agingHeap[V] {
+	h := &agingHeap[V]{
+		constraint: constraint,
+		policy:     policy,
+		scores:     make(map[string]*agingScore[V]),
+		steps:      heap.New[string, *agingStep](agingStepOrder{}),
+		epoch:      time.Now(),
+		now:        time.Now,
+	}
+	h.inner = heap.NewConcurrent[V](&agingConstraint[V]{heap: h})
+	return h
+}
+
+// agingConstraint orders the items of an agingHeap by score, then by the
+// constraint of the queue.
+type agingConstraint[V any] struct {
+	heap *agingHeap[V]
+}
+
+func (c *agingConstraint[V]) FormStoreKey(value V) string {
+	return c.heap.constraint.FormStoreKey(value)
+}
+
+func (c *agingConstraint[V]) Less(left, right V) bool {
+	scoreLeft := c.heap.scores[c.FormStoreKey(left)]
+	scoreRight := c.heap.scores[c.FormStoreKey(right)]
+	if scoreLeft != nil && scoreRight != nil && scoreLeft.score != scoreRight.score {
+		return scoreLeft.score < scoreRight.score
+	}
+	return c.heap.constraint.Less(left, right)
+}
+
+func (h *agingHeap[V]) Add(value V) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := h.constraint.FormStoreKey(value)
+	score, ok := h.scores[key]
+	if !ok {
+		score = &agingScore[V]{enqueuedAt: h.now()}
+		h.scores[key] = score
+		if h.policy.step {
+			h.steps.Add(&agingStep{key: key, at: score.enqueuedAt.Add(h.policy.interval)})
+		}
+	}
+	score.value = value
+	score.priority = h.constraint.Priority(value)
+	h.rescore(score)
+	h.inner.Add(value)
+}
+
+func (h *agingHeap[V]) Delete(value V) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if err := h.inner.Delete(value); err != nil {
+		return err
+	}
+	h.forget(h.constraint.FormStoreKey(value))
+	return nil
+}
+
+func (h *agingHeap[V]) Peek() (V, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ageLocked()
+	return h.inner.Peek()
+}
+
+func (h *agingHeap[V]) PeekN(n int) []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ageLocked()
+	return h.inner.PeekN(n)
+}
+
+func (h *agingHeap[V]) Pop() (V, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ageLocked()
+
+	value, err := h.inner.Pop()
+	if err != nil {
+		return value, err
+	}
+	h.forget(h.constraint.FormStoreKey(value))
+	return value, nil
+}
+
+func (h *agingHeap[V]) PopN(n int) []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ageLocked()
+
+	values := h.inner.PopN(n)
+	for _, value := range values {
+		h.forget(h.constraint.FormStoreKey(value))
+	}
+	return values
+}
+
+func (h *agingHeap[V]) Get(value V) (V, bool) {
+	return h.inner.Get(value)
+}
+
+func (h *agingHeap[V]) List() []V {
+	return h.inner.List()
+}
+
+func (h *agingHeap[V]) Len() int {
+	return h.inner.Len()
+}
+
+// Snapshot exposes the layout of the inner heap.
+func (h *agingHeap[V]) Snapshot() []heap.Node[V] {
+	nodes, _ := heap.Snapshot[V](h.inner)
+	return nodes
+}
+
+// ageLocked fixes the items which crossed a step since the last call.
+func (h *agingHeap[V]) ageLocked() {
+	if !h.policy.step {
+		return
+	}
+	now := h.now()
+	for h.steps.Len() > 0 {
+		next, _ := h.steps.Peek()
+		if next.at.After(now) {
+			return
+		}
+		score := h.scores[next.key]
+		score.steps = int(now.Sub(score.enqueuedAt) / h.policy.interval)
+		h.rescore(score)
+		next.at = score.enqueuedAt.Add(time.Duration(score.steps+1) * h.policy.interval)
+		h.steps.Add(next)
+		// Adding the value again fixes its position.
+		h.inner.Add(score.value)
+	}
+}
+
+func (h *agingHeap[V]) rescore(score *agingScore[V]) {
+	if h.policy.step {
+		score.score = score.priority - h.policy.boost*float64(score.steps)
+		return
+	}
+	rate := h.policy.boost / h.policy.interval.Seconds()
+	score.score = score.priority + rate*score.enqueuedAt.Sub(h.epoch).Seconds()
+}
+
+func (h *agingHeap[V]) forget(key string) {
+	delete(h.scores, key)
+	if h.policy.step {
+		_ = h.steps.Delete(&agingStep{key: key})
+	}
+}
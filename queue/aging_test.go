@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type testPriorityConstraint struct {
+	testConstraint
+}
+
+func (t *testPriorityConstraint) Priority(item *testItem) float64 {
+	return float64(item.value)
+}
+
+func newTestAgingHeap(policy AgingPolicy, now *time.Time) *agingHeap[*testItem] {
+	h := newAgingHeap[*testItem](&testPriorityConstraint{}, policy)
+	h.epoch = *now
+	h.now = func() time.Time { return *now }
+	return h
+}
+
+func TestAgingHeap_Linear(t *testing.T) {
+	now := time.Now()
+	h := newTestAgingHeap(LinearAging(1, time.Second), &now)
+
+	convey.Convey("test linear aging", t, func() {
+		h.Add(&testItem{key: "Item_5", value: 5})
+		now = now.Add(10 * time.Second)
+		h.Add(&testItem{key: "Item_1", value: 1})
+		h.Add(&testItem{key: "Item_3", value: 3})
+
+		// Item_5 aged by 10 and beats the newer items.
+		items := h.PopN(3)
+		convey.So(len(items), convey.ShouldEqual, 3)
+		convey.So(items[0].key, convey.ShouldEqual, "Item_5")
+		convey.So(items[1].key, convey.ShouldEqual, "Item_1")
+		convey.So(items[2].key, convey.ShouldEqual, "Item_3")
+		convey.So(len(h.scores), convey.ShouldEqual, 0)
+	})
+}
+
+func TestAgingHeap_Step(t *testing.T) {
+	now := time.Now()
+	h := newTestAgingHeap(StepAging(2, time.Second), &now)
+
+	convey.Convey("test step aging", t, func() {
+		h.Add(&testItem{key: "Item_5", value: 5})
+		now = now.Add(500 * time.Millisecond)
+		h.Add(&testItem{key: "Item_4", value: 4})
+
+		head, err := h.Peek()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(head.key, convey.ShouldEqual, "Item_4")
+
+		convey.Convey("test an item crossing a step moves up", func() {
+			now = now.Add(700 * time.Millisecond)
+			head, err := h.Peek()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(head.key, convey.ShouldEqual, "Item_5")
+
+			// Updating the item keeps its age: 7-2 is behind 4.
+			h.Add(&testItem{key: "Item_5", value: 7})
+			head, _ = h.Peek()
+			convey.So(head.key, convey.ShouldEqual, "Item_4")
+
+			now = now.Add(time.Second)
+			item, err := h.Pop()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.key, convey.ShouldEqual, "Item_4")
+			convey.So(h.steps.Len(), convey.ShouldEqual, 1)
+			convey.So(h.scores["Item_5"].steps, convey.ShouldEqual, 2)
+
+			convey.So(h.Delete(&testItem{key: "Item_5"}), convey.ShouldBeNil)
+			convey.So(h.steps.Len(), convey.ShouldEqual, 0)
+		})
+	})
+}
+
+func TestBlockQueue_Aging(t *testing.T) {
+	convey.Convey("test block queue with aging", t, func() {
+		queue := newBlockQueue[*testItem](&testPriorityConstraint{}, WithAging(LinearAging(1, 10*time.Millisecond)))
+		queue.Add(&testItem{key: "Item_9", value: 9})
+		time.Sleep(150 * time.Millisecond)
+		queue.Add(&testItem{key: "Item_0", value: 0})
+
+		item, err := queue.Pop()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(item.key, convey.ShouldEqual, "Item_9")
+
+	})
+
+	convey.Convey("test misconfigured aging", t, func() {
+		// Without a PriorityConstraint the items do not age.
+		queue := newBlockQueue[*testItem](&testConstraint{}, WithAging(StepAging(1, time.Second)))
+		_, aging := queue.heap.Heap.(*agingHeap[*testItem])
+		convey.So(aging, convey.ShouldBeFalse)
+
+		for _, policy := range []AgingPolicy{LinearAging(1, 0), StepAging(1, -time.Second)} {
+			queue := newBlockQueue[*testItem](&testPriorityConstraint{}, WithAging(policy))
+			_, aging := queue.heap.Heap.(*agingHeap[*testItem])
+			convey.So(aging, convey.ShouldBeFalse)
+			queue.Add(&testItem{key: "Item_1", value: 1})
+			queue.Add(&testItem{key: "Item_0", value: 0})
+			item, err := queue.Pop()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.key, convey.ShouldEqual, "Item_0")
+
+			_, err = NewAgingQueue[*testItem](&testPriorityConstraint{}, policy)
+			convey.So(err, convey.ShouldEqual, ErrInvalidAging)
+		}
+
+		checked, err := NewAgingQueue[*testItem](&testPriorityConstraint{}, StepAging(1, time.Second))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(checked, convey.ShouldNotBeNil)
+	})
+}
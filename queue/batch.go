@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// PopBatch blocks until an item is available, then keeps collecting items
+// until it has max of them or maxWait elapsed since the first one. The items
+// are returned in priority order.
+func (que *blockQueue[V]) PopBatch(max int, maxWait time.Duration) ([]V, error) {
+	return que.PopBatchContext(context.Background(), max, maxWait)
+}
+
+// PopBatchContext is PopBatch giving up with ctx.Err() if ctx is done before
+// the first item. When ctx is done or the queue is shut down while collecting,
+// the items collected so far are returned.
+func (que *blockQueue[V]) PopBatchContext(ctx context.Context, max int, maxWait time.Duration) ([]V, error) {
+	if max <= 0 {
+		return nil, nil
+	}
+
+	que.cond.L.Lock()
+	items, err := que.popBatchLocked(ctx, max, maxWait)
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	if err == nil {
+		que.cond.Broadcast()
+	}
+	notify()
+	return items, err
+}
+
+func (que *blockQueue[V]) popBatchLocked(ctx context.Context, max int, maxWait time.Duration) ([]V, error) {
+	items, err := que.popNLocked(ctx, max)
+	if err != nil || len(items) >= max || maxWait <= 0 {
+		return items, err
+	}
+
+	batchCtx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+	for len(items) < max {
+		if err = que.waitLocked(batchCtx); err != nil || que.stopping {
+			break
+		}
+		que.expireLocked()
+		more := que.heap.PopN(max - len(items))
+		que.takeLocked(more...)
+		items = append(items, more...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return que.constraint.Less(items[i], items[j])
+	})
+	return items, nil
+}
+
+// PopBatch pops a batch of ready items like BlockQueue.PopBatch.
+func (q *delayingQueue[V]) PopBatch(max int, maxWait time.Duration) ([]V, error) {
+	return q.mainQueue.PopBatch(max, maxWait)
+}
+
+// PopBatchContext pops a batch of ready items like
+// BlockQueue.PopBatchContext.
+func (q *delayingQueue[V]) PopBatchContext(ctx context.Context, max int, maxWait time.Duration) ([]V, error) {
+	return q.mainQueue.PopBatchContext(ctx, max, maxWait)
+}
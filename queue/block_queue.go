@@ -1,37 +1,136 @@
 package queue
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/LiuYuuChen/algorithms/heap"
 )
 
 type blockQueue[V any] struct {
-	cond *sync.Cond
-	heap heap.Heap[V]
+	cond       *notifier
+	heap       *trackedHeap[V]
+	constraint HeapConstraint[V]
+	opts       options
+	// processing is only set for work queues.
+	processing *processing[V]
+	// partitions is only set for partitioned queues.
+	partitions *partitionHeap[V]
+	// events fans the changes of the queue out to its watchers.
+	events *watchers[V]
+	// stopCh is closed once the queue stops serving the streams of Chan:
+	// on Shutdown or ShutdownWithDiscard, and once a drain ended.
+	stopCh chan struct{}
+	// expired holds the items dropped by expireLocked until notifyLocked
+	// hands them to OnExpire.
+	expired []V
 
 	globalCnt uint64
 	stopping  bool
 	stopped   bool
+	// draining is set by ShutdownWithDrain: pops keep being served until
+	// the queue is empty and no item is in flight.
+	draining bool
+	// aboveHigh is set once the length reached the high watermark and
+	// reset once it fell back to the low watermark.
+	aboveHigh bool
 }
 
-func NewBlockQueue[V any](constraint HeapConstraint[V]) BlockQueue[V] {
-	return newBlockQueue[V](constraint)
+func NewBlockQueue[V any](constraint HeapConstraint[V], opts ...Option) BlockQueue[V] {
+	return newBlockQueue[V](constraint, opts...)
 }
 
-func newBlockQueue[V any](constraint HeapConstraint[V]) *blockQueue[V] {
-	return &blockQueue[V]{
-		cond: sync.NewCond(&sync.RWMutex{}),
-		heap: heap.NewConcurrent[V](constraint),
+func newBlockQueue[V any](constraint HeapConstraint[V], opts ...Option) *blockQueue[V] {
+	cfg := newOptions(opts)
+	return newBlockQueueWith[V](constraint, newItemHeap[V](constraint, cfg), cfg)
+}
+
+// newBlockQueueWith builds a block queue storing its items in inner.
+func newBlockQueueWith[V any](constraint HeapConstraint[V], inner heap.Heap[V], cfg options) *blockQueue[V] {
+	que := &blockQueue[V]{
+		cond:       newNotifier(&sync.RWMutex{}),
+		heap:       newTrackedHeap[V](inner, constraint, cfg.metrics).withTTL(ttlOf(constraint, cfg)),
+		constraint: constraint,
+		opts:       cfg,
+		events:     newWatchers[V](cfg),
+		stopCh:     make(chan struct{}),
 	}
+	que.heap.emit = que.events.emit
+	return que
 }
 
+// Add adds or updates an item. When the queue is full it follows the
+// overflow policy: it waits for room, drops the item or evicts the lowest
+// priority item.
 func (que *blockQueue[V]) Add(value V) {
+	_ = que.AddContext(context.Background(), value)
+}
+
+// AddContext adds or updates an item. When the queue is full it waits for
+// room until ctx is done under OverflowBlock, fails with ErrFull under
+// OverflowReject and evicts the lowest priority item under OverflowEvict.
+func (que *blockQueue[V]) AddContext(ctx context.Context, value V) error {
 	que.cond.L.Lock()
-	que.heap.Add(value)
+	err := que.addLocked(ctx, value, true)
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	que.cond.Broadcast()
+	notify()
+	return err
+}
+
+// TryAdd adds or updates an item without blocking. It fails with ErrFull
+// when the queue is full, unless the overflow policy is OverflowEvict.
+func (que *blockQueue[V]) TryAdd(value V) error {
+	que.cond.L.Lock()
+	err := que.addLocked(context.Background(), value, false)
+	notify := que.notifyLocked()
 	que.cond.L.Unlock()
 	que.cond.Broadcast()
+	notify()
+	return err
+}
+
+func (que *blockQueue[V]) addLocked(ctx context.Context, value V, block bool) error {
+	if que.stopping {
+		return ErrShutdown
+	}
+	que.expireLocked()
+
+	if que.deferLocked(value) {
+		return nil
+	}
+
+	if _, ok := que.heap.Get(value); ok || !que.fullLocked() {
+		que.heap.Add(value)
+		return nil
+	}
+
+	switch que.opts.overflow {
+	case OverflowEvict:
+		return que.evictLocked(value)
+	case OverflowBlock:
+		if block {
+			break
+		}
+		fallthrough
+	default:
+		return ErrFull
+	}
+
+	err := que.waitForLocked(ctx, func() bool {
+		return !que.fullLocked() || que.stopping
+	})
+	if err != nil {
+		return err
+	}
+	if que.stopping {
+		return ErrShutdown
+	}
+	que.heap.Add(value)
+	return nil
 }
 
 func (que *blockQueue[V]) Update(value V) error {
@@ -39,7 +138,15 @@ func (que *blockQueue[V]) Update(value V) error {
 	defer que.cond.Broadcast()
 	defer que.cond.L.Unlock()
 	if que.stopping {
-		return fmt.Errorf("can not update an item to a closing queue")
+		return ErrShutdown
+	}
+
+	if que.processing != nil {
+		key := que.constraint.FormStoreKey(value)
+		if _, ok := que.processing.dirty[key]; ok {
+			que.processing.dirty[key] = value
+			return nil
+		}
 	}
 
 	_, ok := que.heap.Get(value)
@@ -52,11 +159,26 @@ func (que *blockQueue[V]) Update(value V) error {
 }
 
 func (que *blockQueue[V]) Delete(value V) error {
+	que.cond.L.Lock()
+	if que.stopping {
+		que.cond.L.Unlock()
+		return ErrShutdown
+	}
 	err := que.heap.Delete(value)
+	if que.processing != nil {
+		key := que.constraint.FormStoreKey(value)
+		if _, ok := que.processing.dirty[key]; ok {
+			delete(que.processing.dirty, key)
+			err = nil
+		}
+	}
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
 	if err != nil {
 		return err
 	}
 	que.cond.Broadcast()
+	notify()
 	return nil
 }
 
@@ -77,36 +199,204 @@ func (que *blockQueue[V]) Pop() (V, error) {
 }
 
 func (que *blockQueue[V]) BlockPop() (V, error) {
+	return que.PopContext(context.Background())
+}
+
+// PopContext blocks like Pop until an item is available or the queue is shut
+// down. It gives up with ctx.Err() once ctx is done.
+func (que *blockQueue[V]) PopContext(ctx context.Context) (V, error) {
 	que.cond.L.Lock()
-	defer que.cond.L.Unlock()
-BlockLoop:
-	for que.heap.Len() == 0 && !que.stopping {
-		que.cond.Wait()
+	item, err := que.popLocked(ctx)
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	if err == nil {
+		que.cond.Broadcast()
 	}
+	notify()
+	return item, err
+}
 
-	if que.stopped {
-		return *new(V), fmt.Errorf("pop a closed queue")
+func (que *blockQueue[V]) popLocked(ctx context.Context) (V, error) {
+BlockLoop:
+	if err := que.waitLocked(ctx); err != nil {
+		return *new(V), err
 	}
+	que.expireLocked()
 
-	if que.stopping {
-		que.stopped = true
+	if err := que.checkStoppedLocked(); err != nil {
+		return *new(V), err
 	}
 
 	item, err := que.heap.Pop()
 	if err != nil {
+		que.notifyWaitingLocked()
 		goto BlockLoop
 	}
 
+	que.takeLocked(item)
 	return item, nil
 }
 
+// TryPop pops the head of the queue without blocking. It returns false when
+// the queue is empty or has been stopped. After Shutdown it follows Pop: the
+// first call still hands out an item, if any, and stops the queue.
+func (que *blockQueue[V]) TryPop() (V, bool) {
+	que.cond.L.Lock()
+	item, ok := que.tryPopLocked()
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	if ok {
+		que.cond.Broadcast()
+	}
+	notify()
+	return item, ok
+}
+
+func (que *blockQueue[V]) tryPopLocked() (V, bool) {
+	que.expireLocked()
+	if err := que.checkStoppedLocked(); err != nil {
+		return *new(V), false
+	}
+
+	item, err := que.heap.Pop()
+	if err != nil {
+		return *new(V), false
+	}
+	que.takeLocked(item)
+	return item, true
+}
+
+// PopTimeout blocks like Pop for at most timeout, then gives up with
+// ErrTimeout.
+func (que *blockQueue[V]) PopTimeout(timeout time.Duration) (V, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	item, err := que.PopContext(ctx)
+	if err == context.DeadlineExceeded {
+		return item, ErrTimeout
+	}
+	return item, err
+}
+
+// PopN blocks until the queue has at least one item and then pops up to n
+// items in priority order under a single lock acquisition.
+func (que *blockQueue[V]) PopN(n int) ([]V, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	que.cond.L.Lock()
+	items, err := que.popNLocked(context.Background(), n)
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	if err == nil {
+		que.cond.Broadcast()
+	}
+	notify()
+	return items, err
+}
+
+func (que *blockQueue[V]) popNLocked(ctx context.Context, n int) ([]V, error) {
+BlockLoop:
+	if err := que.waitLocked(ctx); err != nil {
+		return nil, err
+	}
+	que.expireLocked()
+
+	if err := que.checkStoppedLocked(); err != nil {
+		return nil, err
+	}
+
+	items := que.heap.PopN(n)
+	if len(items) == 0 {
+		que.notifyWaitingLocked()
+		goto BlockLoop
+	}
+
+	que.takeLocked(items...)
+	return items, nil
+}
+
+// waitLocked blocks until the queue has an item, is shutting down or ctx is
+// done. It must be called with que.cond.L held.
+func (que *blockQueue[V]) waitLocked(ctx context.Context) error {
+	return que.waitForLocked(ctx, func() bool {
+		if que.readyLocked() || que.stopped {
+			return true
+		}
+		// A draining queue waits for the items in flight, which may be
+		// requeued when they are done.
+		return que.stopping && (!que.draining || que.drainedLocked())
+	})
+}
+
+// readyLocked reports whether an item can be popped. Items of a partition
+// with an item in flight can not.
+func (que *blockQueue[V]) readyLocked() bool {
+	if que.partitions != nil {
+		return que.partitions.ready()
+	}
+	return que.heap.Len() > 0
+}
+
+// waitForLocked blocks until ready returns true or ctx is done. It must be
+// called with que.cond.L held. A waiter giving up does not wake the other
+// waiters up.
+func (que *blockQueue[V]) waitForLocked(ctx context.Context, ready func() bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for !ready() {
+		wake := que.cond.wait()
+		que.cond.L.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+		}
+		que.cond.L.Lock()
+		que.cond.leave(wake)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStoppedLocked fails once the queue is stopped. The first pop after
+// Shutdown still hands out an item and stops the queue, while a draining
+// queue keeps handing out items until it is empty.
+func (que *blockQueue[V]) checkStoppedLocked() error {
+	if que.stopped {
+		return ErrShutdown
+	}
+
+	if que.draining {
+		if que.heap.Len() == 0 {
+			return ErrShutdown
+		}
+		return nil
+	}
+
+	if que.stopping {
+		que.stopped = true
+	}
+	return nil
+}
+
 func (que *blockQueue[V]) Len() int {
 	return que.heap.Len()
 }
 
+// Shutdown stops the queue without draining it: the next pop still hands out
+// an item, if any, and the following ones fail. See ShutdownWithDrain and
+// ShutdownWithDiscard for explicit semantics.
 func (que *blockQueue[V]) Shutdown() {
 	que.cond.L.Lock()
 	que.stopping = true
+	que.events.shutdown()
+	que.closeWatchersLocked()
+	que.closeStopLocked()
 	que.cond.L.Unlock()
 	que.cond.Broadcast()
 }
@@ -126,3 +416,17 @@ func (que *blockQueue[V]) Peek() (V, error) {
 	que.cond.Broadcast()
 	return v, nil
 }
+
+// PeekN returns up to n items from the head of the queue in priority order
+// without removing them.
+func (que *blockQueue[V]) PeekN(n int) []V {
+	return que.heap.PeekN(n)
+}
+
+// newItemHeap returns the heap ordering the items as configured by cfg.
+func newItemHeap[V any](constraint HeapConstraint[V], cfg options) heap.Heap[V] {
+	if prioritized, ok := constraint.(PriorityConstraint[V]); ok && cfg.aging != nil {
+		return newAgingHeap[V](prioritized, *cfg.aging)
+	}
+	return heap.NewConcurrent[V](constraint)
+}
@@ -1,9 +1,11 @@
 package queue
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -27,6 +29,13 @@ func (t *testConstraint) Less(left, right *testItem) bool {
 	return left.value < right.value
 }
 
+// eventually waits up to a second for cond to hold.
+func eventually(cond func() bool) {
+	for deadline := time.Now().Add(time.Second); !cond() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func Test_BasicBlockQueueFunction(t *testing.T) {
 	queue := newBlockQueue[*testItem](&testConstraint{})
 	testItems := make([]*testItem, testItemNum)
@@ -204,6 +213,454 @@ func Test_BlockQueueConcurrent(t *testing.T) {
 	})
 }
 
+func Test_BlockQueuePopNAndPeekN(t *testing.T) {
+	queue := newBlockQueue[*testItem](&testConstraint{})
+	for i := testItemNum - 1; i >= 0; i-- {
+		queue.Add(&testItem{
+			key:   fmt.Sprintf("Item_%d", i),
+			value: i,
+		})
+	}
+
+	convey.Convey("test PopN and PeekN", t, func() {
+		convey.Convey("test PeekN", func() {
+			items := queue.PeekN(3)
+			convey.So(len(items), convey.ShouldEqual, 3)
+			for i, item := range items {
+				convey.So(item.value, convey.ShouldEqual, i)
+			}
+			convey.So(queue.Len(), convey.ShouldEqual, testItemNum)
+		})
+
+		convey.Convey("test PopN", func() {
+			items, err := queue.PopN(4)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(items), convey.ShouldEqual, 4)
+			for i, item := range items {
+				convey.So(item.value, convey.ShouldEqual, i)
+			}
+
+			items, err = queue.PopN(testItemNum)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(items), convey.ShouldEqual, testItemNum-4)
+			convey.So(queue.Len(), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test PopN wait", func() {
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				queue.Add(&testItem{key: "Item_11"})
+			}()
+
+			items, err := queue.PopN(2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(items), convey.ShouldEqual, 1)
+			convey.So(items[0].key, convey.ShouldEqual, "Item_11")
+		})
+	})
+}
+
+func Test_BlockQueuePopContext(t *testing.T) {
+	queue := newBlockQueue[*testItem](&testConstraint{})
+
+	convey.Convey("test context-aware and timed pops", t, func() {
+		convey.Convey("test PopContext cancel", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}()
+			_, err := queue.PopContext(ctx)
+			convey.So(err, convey.ShouldEqual, context.Canceled)
+		})
+
+		convey.Convey("test PopTimeout", func() {
+			start := time.Now()
+			_, err := queue.PopTimeout(50 * time.Millisecond)
+			convey.So(err, convey.ShouldEqual, ErrTimeout)
+			convey.So(time.Since(start), convey.ShouldBeLessThan, time.Second)
+		})
+
+		convey.Convey("test other waiters are not disturbed", func() {
+			result := make(chan *testItem, 1)
+			go func() {
+				item, err := queue.Pop()
+				if err == nil {
+					result <- item
+				}
+			}()
+
+			_, err := queue.PopTimeout(50 * time.Millisecond)
+			convey.So(err, convey.ShouldEqual, ErrTimeout)
+
+			queue.Add(&testItem{key: "Item_0"})
+			select {
+			case item := <-result:
+				convey.So(item.key, convey.ShouldEqual, "Item_0")
+			case <-time.After(time.Second):
+				t.Fatal("the blocked Pop did not receive the item")
+			}
+			convey.So(queue.Len(), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test a timed out pop does not wake the other waiters up", func() {
+			var checks int32
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				queue.cond.L.Lock()
+				_ = queue.waitForLocked(context.Background(), func() bool {
+					atomic.AddInt32(&checks, 1)
+					return queue.heap.Len() > 0
+				})
+				queue.cond.L.Unlock()
+			}()
+			eventually(func() bool { return atomic.LoadInt32(&checks) == 1 })
+
+			_, err := queue.PopTimeout(20 * time.Millisecond)
+			convey.So(err, convey.ShouldEqual, ErrTimeout)
+			time.Sleep(20 * time.Millisecond)
+			convey.So(atomic.LoadInt32(&checks), convey.ShouldEqual, 1)
+
+			queue.Add(&testItem{key: "Item_2"})
+			<-done
+			convey.So(atomic.LoadInt32(&checks), convey.ShouldEqual, 2)
+			_, err = queue.Pop()
+			convey.So(err, convey.ShouldBeNil)
+		})
+
+		convey.Convey("test PopContext returns an available item", func() {
+			queue.Add(&testItem{key: "Item_1"})
+			item, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.key, convey.ShouldEqual, "Item_1")
+		})
+	})
+}
+
+func Test_BlockQueueTryPop(t *testing.T) {
+	queue := newBlockQueue[*testItem](&testConstraint{})
+
+	convey.Convey("test TryPop", t, func() {
+		_, ok := queue.TryPop()
+		convey.So(ok, convey.ShouldBeFalse)
+
+		queue.Add(&testItem{key: "Item_1", value: 1})
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		item, ok := queue.TryPop()
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(item.key, convey.ShouldEqual, "Item_0")
+
+		convey.Convey("test TryPop after shutdown", func() {
+			queue.Add(&testItem{key: "Item_2", value: 2})
+			queue.Shutdown()
+			item, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(item.key, convey.ShouldEqual, "Item_1")
+
+			_, ok = queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+		})
+	})
+}
+
+func Test_BlockQueueChan(t *testing.T) {
+	queue := newBlockQueue[*testItem](&testConstraint{})
+	for i := testItemNum - 1; i >= 0; i-- {
+		queue.Add(&testItem{
+			key:   fmt.Sprintf("Item_%d", i),
+			value: i,
+		})
+	}
+
+	convey.Convey("test channel consumption", t, func() {
+		convey.Convey("test items are delivered in priority order", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			ch := queue.Chan(ctx)
+			for i := 0; i < testItemNum-1; i++ {
+				item := <-ch
+				convey.So(item.value, convey.ShouldEqual, i)
+			}
+
+			// The last item is waiting to be delivered; it must go back to
+			// the queue once the context is canceled.
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			_, ok := <-ch
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("test shutdown ends a stream nobody reads", func() {
+			idle := newBlockQueue[*testItem](&testConstraint{})
+			idle.Add(&testItem{key: "Item_0"})
+			ch := idle.Chan(context.Background())
+			eventually(func() bool { return idle.Len() == 0 })
+
+			idle.Shutdown()
+			eventually(func() bool { return idle.Len() == 1 })
+			select {
+			case _, ok := <-ch:
+				convey.So(ok, convey.ShouldBeFalse)
+			case <-time.After(time.Second):
+				t.Fatal("channel is not closed after shutdown")
+			}
+			convey.So(idle.Len(), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("test channel is closed on shutdown", func() {
+			ch := queue.Chan(context.Background())
+			item := <-ch
+			convey.So(item.value, convey.ShouldEqual, testItemNum-1)
+
+			queue.Shutdown()
+			select {
+			case _, ok := <-ch:
+				convey.So(ok, convey.ShouldBeFalse)
+			case <-time.After(time.Second):
+				t.Fatal("channel is not closed after shutdown")
+			}
+		})
+	})
+}
+
+func Test_BoundedBlockQueue(t *testing.T) {
+	newItem := func(i int) *testItem {
+		return &testItem{key: fmt.Sprintf("Item_%d", i), value: i}
+	}
+
+	convey.Convey("test bounded block queue", t, func() {
+		convey.Convey("test reject policy", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{}, WithCapacity(2, OverflowReject))
+			convey.So(queue.TryAdd(newItem(1)), convey.ShouldBeNil)
+			convey.So(queue.TryAdd(newItem(2)), convey.ShouldBeNil)
+			convey.So(queue.TryAdd(newItem(3)), convey.ShouldEqual, ErrFull)
+			convey.So(queue.AddContext(context.Background(), newItem(3)), convey.ShouldEqual, ErrFull)
+			// Updates do not need room.
+			convey.So(queue.TryAdd(&testItem{key: "Item_2", value: 0}), convey.ShouldBeNil)
+			convey.So(queue.Len(), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("test evict policy", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{}, WithCapacity(2, OverflowEvict))
+			queue.Add(newItem(1))
+			queue.Add(newItem(3))
+			convey.So(queue.TryAdd(newItem(2)), convey.ShouldBeNil)
+			_, ok := queue.Get(newItem(3))
+			convey.So(ok, convey.ShouldBeFalse)
+
+			convey.So(queue.TryAdd(newItem(4)), convey.ShouldEqual, ErrFull)
+			items := queue.PeekN(2)
+			convey.So(items[0].value, convey.ShouldEqual, 1)
+			convey.So(items[1].value, convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("test block policy", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{}, WithCapacity(1, OverflowBlock))
+			queue.Add(newItem(1))
+			convey.So(queue.TryAdd(newItem(2)), convey.ShouldEqual, ErrFull)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			convey.So(queue.AddContext(ctx, newItem(2)) == context.DeadlineExceeded, convey.ShouldBeTrue)
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				_, _ = queue.Pop()
+			}()
+			convey.So(queue.AddContext(context.Background(), newItem(2)), convey.ShouldBeNil)
+			item, err := queue.Peek()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.value, convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("test watermarks", func() {
+			var events []string
+			queue := newBlockQueue[*testItem](&testConstraint{}, WithWatermarks(3, 1,
+				func(length int) { events = append(events, fmt.Sprintf("high %d", length)) },
+				func(length int) { events = append(events, fmt.Sprintf("low %d", length)) },
+			))
+			for i := 0; i < 4; i++ {
+				queue.Add(newItem(i))
+			}
+			for i := 0; i < 4; i++ {
+				_, _ = queue.Pop()
+			}
+			queue.Add(newItem(0))
+			convey.So(events, convey.ShouldResemble, []string{"high 3", "low 1"})
+		})
+	})
+}
+
+func Test_BlockQueueShutdownModes(t *testing.T) {
+	newItem := func(i int) *testItem {
+		return &testItem{key: fmt.Sprintf("Item_%d", i), value: i}
+	}
+
+	convey.Convey("test drain and discard shutdowns", t, func() {
+		convey.Convey("test drain serves every item", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{})
+			for i := 0; i < 3; i++ {
+				queue.Add(newItem(i))
+			}
+
+			drained := make(chan error, 1)
+			go func() {
+				drained <- queue.ShutdownWithDrain(context.Background())
+			}()
+			time.Sleep(10 * time.Millisecond)
+			convey.So(queue.IsShutdown(), convey.ShouldBeTrue)
+			convey.So(queue.TryAdd(newItem(3)), convey.ShouldNotBeNil)
+
+			for i := 0; i < 3; i++ {
+				item, err := queue.Pop()
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(item.value, convey.ShouldEqual, i)
+			}
+			convey.So(<-drained, convey.ShouldBeNil)
+			_, err := queue.Pop()
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("test drain waits for items in flight", func() {
+			queue := newWorkQueue[*testItem](&testConstraint{})
+			queue.Add(newItem(0))
+			item, _ := queue.Pop()
+
+			queue.Add(newItem(0))
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				queue.Done(item)
+			}()
+			drained := make(chan error, 1)
+			go func() {
+				drained <- queue.ShutdownWithDrain(context.Background())
+			}()
+
+			// The item added while in flight is served before the drain ends.
+			again, err := queue.Pop()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(again.key, convey.ShouldEqual, item.key)
+			queue.Done(again)
+			convey.So(<-drained, convey.ShouldBeNil)
+		})
+
+		convey.Convey("test drain gives up when ctx is done", func() {
+			queue := newWorkQueue[*testItem](&testConstraint{})
+			queue.Add(newItem(0))
+			_, _ = queue.Pop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := queue.ShutdownWithDrain(ctx)
+			convey.So(err == context.DeadlineExceeded, convey.ShouldBeTrue)
+			_, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("test discard", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{})
+			for i := 2; i >= 0; i-- {
+				queue.Add(newItem(i))
+			}
+
+			items := queue.ShutdownWithDiscard()
+			convey.So(len(items), convey.ShouldEqual, 3)
+			for i, item := range items {
+				convey.So(item.value, convey.ShouldEqual, i)
+			}
+			convey.So(queue.Len(), convey.ShouldEqual, 0)
+			_, err := queue.Pop()
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func Test_BlockQueueAfterShutdown(t *testing.T) {
+	queue := newBlockQueue[*testItem](&testConstraint{})
+	queue.Add(&testItem{key: "Item_0", value: 0})
+	queue.Add(&testItem{key: "Item_1", value: 1})
+	queue.Shutdown()
+
+	convey.Convey("test operations after shutdown", t, func() {
+		convey.Convey("test mutations are rejected", func() {
+			item := &testItem{key: "Item_2", value: 2}
+			convey.So(queue.TryAdd(item), convey.ShouldEqual, ErrShutdown)
+			convey.So(queue.AddContext(context.Background(), item), convey.ShouldEqual, ErrShutdown)
+			queue.Add(item)
+			convey.So(queue.Len(), convey.ShouldEqual, 2)
+
+			convey.So(queue.Update(&testItem{key: "Item_0", value: 5}), convey.ShouldEqual, ErrShutdown)
+			convey.So(queue.Delete(&testItem{key: "Item_0"}), convey.ShouldEqual, ErrShutdown)
+		})
+
+		convey.Convey("test reads remain valid", func() {
+			item, ok := queue.Get(&testItem{key: "Item_1"})
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(item.value, convey.ShouldEqual, 1)
+			convey.So(len(queue.List()), convey.ShouldEqual, 2)
+			convey.So(len(queue.PeekN(2)), convey.ShouldEqual, 2)
+			head, err := queue.Peek()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(head.key, convey.ShouldEqual, "Item_0")
+			convey.So(queue.IsShutdown(), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func Test_BlockQueuePopBatch(t *testing.T) {
+	queue := newBlockQueue[*testItem](&testConstraint{})
+	newItem := func(i int) *testItem {
+		return &testItem{key: fmt.Sprintf("Item_%d", i), value: i}
+	}
+
+	convey.Convey("test PopBatch", t, func() {
+		convey.Convey("test batch is full", func() {
+			for i := 4; i >= 0; i-- {
+				queue.Add(newItem(i))
+			}
+			items, err := queue.PopBatch(3, time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(items), convey.ShouldEqual, 3)
+			convey.So(queue.Len(), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("test batch waits for more items in priority order", func() {
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				queue.Add(newItem(1))
+			}()
+			items, err := queue.PopBatch(10, 100*time.Millisecond)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(items), convey.ShouldEqual, 3)
+			for i, value := range []int{1, 3, 4} {
+				convey.So(items[i].value, convey.ShouldEqual, value)
+			}
+		})
+
+		convey.Convey("test ctx is done before the first item", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := queue.PopBatchContext(ctx, 10, time.Second)
+			convey.So(err == context.DeadlineExceeded, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("test shutdown while collecting", func() {
+			queue.Add(newItem(0))
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				queue.Shutdown()
+			}()
+			start := time.Now()
+			items, err := queue.PopBatch(10, time.Minute)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(items), convey.ShouldEqual, 1)
+			convey.So(time.Since(start), convey.ShouldBeLessThan, time.Second)
+		})
+	})
+}
+
 func randInt(scope [2]int) int {
 	rand.Seed(time.Now().UnixNano())
 	if scope[0] > scope[1] {
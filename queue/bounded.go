@@ -0,0 +1,102 @@
+package queue
+
+import "context"
+
+// fullLocked reports whether the queue reached its capacity.
+func (que *blockQueue[V]) fullLocked() bool {
+	return que.opts.capacity > 0 && que.heap.Len() >= que.opts.capacity
+}
+
+// waitRoom waits for room for value as addLocked would, without adding it.
+// Values already in the queue or in flight always have room, and so has any
+// value under OverflowEvict, which only makes room once the value is added.
+func (que *blockQueue[V]) waitRoom(ctx context.Context, value V, block bool) error {
+	que.cond.L.Lock()
+	defer que.cond.L.Unlock()
+	if que.stopping {
+		return ErrShutdown
+	}
+
+	if que.processing != nil {
+		if _, ok := que.processing.inFlight[que.constraint.FormStoreKey(value)]; ok {
+			return nil
+		}
+	}
+	if _, ok := que.heap.Get(value); ok || !que.fullLocked() {
+		return nil
+	}
+
+	switch que.opts.overflow {
+	case OverflowEvict:
+		return nil
+	case OverflowBlock:
+		if block {
+			break
+		}
+		fallthrough
+	default:
+		return ErrFull
+	}
+
+	err := que.waitForLocked(ctx, func() bool {
+		return !que.fullLocked() || que.stopping
+	})
+	if err != nil {
+		return err
+	}
+	if que.stopping {
+		return ErrShutdown
+	}
+	return nil
+}
+
+// evictLocked makes room for value by dropping the lowest priority item. The
+// new item is rejected with ErrFull when it has the lowest priority itself.
+// Finding the lowest priority item scans the whole heap.
+func (que *blockQueue[V]) evictLocked(value V) error {
+	items := que.heap.List()
+	if len(items) == 0 {
+		que.heap.Add(value)
+		return nil
+	}
+
+	lowest := items[0]
+	for _, item := range items[1:] {
+		if que.constraint.Less(lowest, item) {
+			lowest = item
+		}
+	}
+
+	if !que.constraint.Less(value, lowest) {
+		return ErrFull
+	}
+	if err := que.heap.Delete(lowest); err != nil {
+		return err
+	}
+	que.heap.Add(value)
+	return nil
+}
+
+// watermarkLocked checks whether the length of the queue crossed a watermark
+// and returns the callback to run once the lock is released.
+func (que *blockQueue[V]) watermarkLocked() func() {
+	cfg := que.opts
+	if cfg.highWatermark <= 0 {
+		return func() {}
+	}
+
+	length := que.heap.Len()
+	switch {
+	case !que.aboveHigh && length >= cfg.highWatermark:
+		que.aboveHigh = true
+		if cfg.onHigh != nil {
+			return func() { cfg.onHigh(length) }
+		}
+	case que.aboveHigh && length <= cfg.lowWatermark:
+		que.aboveHigh = false
+		if cfg.onLow != nil {
+			return func() { cfg.onLow(length) }
+		}
+	}
+	return func() {}
+}
@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Attempt records a failed processing of an item.
+type Attempt struct {
+	Time time.Time
+	Err  error
+}
+
+// DeadLetter is an item which failed MaxAttempts times, with its history.
+type DeadLetter[V any] struct {
+	Value     V
+	LastError error
+	Attempts  []Attempt
+	DeadAt    time.Time
+}
+
+type deadLetterConstraint[V any] struct {
+	origin HeapConstraint[V]
+}
+
+func (c *deadLetterConstraint[V]) FormStoreKey(letter *DeadLetter[V]) string {
+	return c.origin.FormStoreKey(letter.Value)
+}
+
+func (c *deadLetterConstraint[V]) Less(left, right *DeadLetter[V]) bool {
+	return left.DeadAt.Before(right.DeadAt)
+}
+
+type deadLetterQueue[V any] struct {
+	*rateLimitingQueue[V]
+	maxAttempts int
+
+	lock     sync.Mutex
+	attempts map[string][]Attempt
+	dead     *blockQueue[*DeadLetter[V]]
+}
+
+// NewDeadLetterQueue returns a RateLimitingQueue which moves an item to a
+// dead-letter queue once Retry was called maxAttempts times for it without
+// a Forget in between.
+func NewDeadLetterQueue[V any](constraint HeapConstraint[V], limiter RateLimiter, maxAttempts int, opts ...Option) DeadLetterQueue[V] {
+	return newDeadLetterQueue[V](constraint, limiter, maxAttempts, opts...)
+}
+
+func newDeadLetterQueue[V any](constraint HeapConstraint[V], limiter RateLimiter, maxAttempts int, opts ...Option) *deadLetterQueue[V] {
+	return &deadLetterQueue[V]{
+		rateLimitingQueue: newRateLimitingQueue[V](constraint, limiter, opts...),
+		maxAttempts:       maxAttempts,
+		attempts:          make(map[string][]Attempt),
+		dead:              newBlockQueue[*DeadLetter[V]](&deadLetterConstraint[V]{origin: constraint}),
+	}
+}
+
+// Retry records a failed attempt of the item. The item is requeued through
+// the rate limiter, or moved to the dead letters once it failed MaxAttempts
+// times, in which case Retry returns true.
+func (q *deadLetterQueue[V]) Retry(value V, err error) bool {
+	key := q.constraint.FormStoreKey(value)
+	q.lock.Lock()
+	attempts := append(q.attempts[key], Attempt{Time: time.Now(), Err: err})
+	if len(attempts) < q.maxAttempts {
+		q.attempts[key] = attempts
+		q.lock.Unlock()
+		q.AddRateLimited(value)
+		return false
+	}
+	delete(q.attempts, key)
+	q.lock.Unlock()
+
+	q.limiter.Forget(key)
+	q.dead.Add(&DeadLetter[V]{
+		Value:     value,
+		LastError: err,
+		Attempts:  attempts,
+		DeadAt:    time.Now(),
+	})
+	return true
+}
+
+// Forget clears the retry history of the item.
+func (q *deadLetterQueue[V]) Forget(value V) {
+	q.lock.Lock()
+	delete(q.attempts, q.constraint.FormStoreKey(value))
+	q.lock.Unlock()
+	q.rateLimitingQueue.Forget(value)
+}
+
+// Attempts returns the failed attempts recorded for an item still retried.
+func (q *deadLetterQueue[V]) Attempts(value V) []Attempt {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return append([]Attempt(nil), q.attempts[q.constraint.FormStoreKey(value)]...)
+}
+
+// DeadLetters lists the dead letters, oldest first.
+func (q *deadLetterQueue[V]) DeadLetters() []DeadLetter[V] {
+	letters := q.dead.PeekN(q.dead.Len())
+	list := make([]DeadLetter[V], 0, len(letters))
+	for _, letter := range letters {
+		list = append(list, *letter)
+	}
+	return list
+}
+
+// DeadLetter returns the dead letter of an item.
+func (q *deadLetterQueue[V]) DeadLetter(value V) (DeadLetter[V], bool) {
+	letter, ok := q.dead.Get(&DeadLetter[V]{Value: value})
+	if !ok {
+		return DeadLetter[V]{}, false
+	}
+	return *letter, true
+}
+
+// Dead returns the dead-letter queue itself, for consumers of dead letters.
+func (q *deadLetterQueue[V]) Dead() BlockQueue[*DeadLetter[V]] {
+	return q.dead
+}
+
+// Redrive moves a dead letter back to the queue with a fresh history. It never
+// waits for room: when the queue does not take the item, for instance with
+// ErrFull, the dead letter is kept.
+func (q *deadLetterQueue[V]) Redrive(value V) error {
+	letter, ok := q.dead.Get(&DeadLetter[V]{Value: value})
+	if !ok {
+		return fmt.Errorf("can not find dead letter: %v", value)
+	}
+	// Deleting first makes sure a concurrent Redrive or Purge of the same
+	// letter does not add the item twice.
+	if err := q.dead.Delete(letter); err != nil {
+		return err
+	}
+	if err := q.TryAdd(letter.Value); err != nil {
+		q.dead.Add(letter)
+		return err
+	}
+	return nil
+}
+
+// RedriveAll moves every dead letter back to the queue and returns how many
+// were moved. The dead letters the queue has no room for are kept.
+func (q *deadLetterQueue[V]) RedriveAll() int {
+	moved := 0
+	for _, letter := range q.dead.List() {
+		if q.Redrive(letter.Value) == nil {
+			moved++
+		}
+	}
+	return moved
+}
+
+// Purge drops a dead letter.
+func (q *deadLetterQueue[V]) Purge(value V) error {
+	return q.dead.Delete(&DeadLetter[V]{Value: value})
+}
+
+// PurgeAll drops every dead letter and returns how many were dropped.
+func (q *deadLetterQueue[V]) PurgeAll() int {
+	purged := 0
+	for _, letter := range q.dead.List() {
+		if q.dead.Delete(letter) == nil {
+			purged++
+		}
+	}
+	return purged
+}
+
+func (q *deadLetterQueue[V]) Shutdown() {
+	q.rateLimitingQueue.Shutdown()
+	q.dead.Shutdown()
+}
+
+func (q *deadLetterQueue[V]) ShutdownWithDrain(ctx context.Context) error {
+	defer q.dead.Shutdown()
+	return q.rateLimitingQueue.ShutdownWithDrain(ctx)
+}
+
+func (q *deadLetterQueue[V]) ShutdownWithDiscard() []V {
+	defer q.dead.Shutdown()
+	return q.rateLimitingQueue.ShutdownWithDiscard()
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeadLetterQueue(t *testing.T) {
+	queue := newDeadLetterQueue[*testItem](&testConstraint{},
+		NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond), 3)
+	defer queue.Shutdown()
+
+	fail := func(item *testItem) bool {
+		popped, err := queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(popped.key, convey.ShouldEqual, item.key)
+		return queue.Retry(popped, fmt.Errorf("attempt %d", len(queue.Attempts(popped))+1))
+	}
+
+	convey.Convey("test dead letters", t, func() {
+		item := &testItem{key: "Item_0"}
+		queue.Add(item)
+		convey.So(fail(item), convey.ShouldBeFalse)
+		convey.So(fail(item), convey.ShouldBeFalse)
+		convey.So(len(queue.Attempts(item)), convey.ShouldEqual, 2)
+		convey.So(fail(item), convey.ShouldBeTrue)
+
+		convey.So(queue.Len(), convey.ShouldEqual, 0)
+		convey.So(len(queue.Attempts(item)), convey.ShouldEqual, 0)
+		letters := queue.DeadLetters()
+		convey.So(len(letters), convey.ShouldEqual, 1)
+		letter, ok := queue.DeadLetter(item)
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(letter.LastError.Error(), convey.ShouldEqual, "attempt 3")
+		convey.So(len(letter.Attempts), convey.ShouldEqual, 3)
+		convey.So(queue.Dead().Len(), convey.ShouldEqual, 1)
+
+		convey.Convey("test redrive", func() {
+			convey.So(queue.Redrive(item), convey.ShouldBeNil)
+			convey.So(len(queue.DeadLetters()), convey.ShouldEqual, 0)
+			convey.So(fail(item), convey.ShouldBeFalse)
+			queue.Forget(item)
+			convey.So(len(queue.Attempts(item)), convey.ShouldEqual, 0)
+			queue.Add(item)
+			popped, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(popped.key, convey.ShouldEqual, item.key)
+		})
+
+		convey.Convey("test purge", func() {
+			convey.So(queue.Purge(item), convey.ShouldBeNil)
+			convey.So(queue.Redrive(item), convey.ShouldNotBeNil)
+			convey.So(queue.PurgeAll(), convey.ShouldEqual, 0)
+		})
+	})
+}
+
+func TestDeadLetterQueue_RedriveFull(t *testing.T) {
+	convey.Convey("test a dead letter the queue has no room for is kept", t, func() {
+		for _, policy := range []OverflowPolicy{OverflowReject, OverflowBlock} {
+			queue := newDeadLetterQueue[*testItem](&testConstraint{},
+				NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond), 1,
+				WithCapacity(1, policy))
+
+			item := &testItem{key: "Item_0"}
+			queue.Add(item)
+			popped, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(queue.Retry(popped, fmt.Errorf("attempt 1")), convey.ShouldBeTrue)
+			queue.Add(&testItem{key: "Item_1", value: 1})
+
+			redriven := make(chan error, 1)
+			go func() {
+				redriven <- queue.Redrive(item)
+			}()
+			select {
+			case err := <-redriven:
+				convey.So(err, convey.ShouldEqual, ErrFull)
+			case <-time.After(time.Second):
+				t.Fatal("Redrive waited for room")
+			}
+			convey.So(queue.RedriveAll(), convey.ShouldEqual, 0)
+			_, ok := queue.DeadLetter(item)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+			queue.Shutdown()
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+type debounceOptions struct {
+	quiet    time.Duration
+	maxDelay time.Duration
+	merge    func(old, new any) any
+}
+
+// WithDebounce makes the Add of a DelayingQueue coalesce the updates of an
+// item: the item gets ready once no Add came for quiet, but no later than
+// maxDelay after its first Add; maxDelay <= 0 never forces it. Each Add of
+// an item already in the queue merges the queued value with the new one
+// through merge, which keeps the new value when nil. AddAfter is not
+// debounced, and the option has no effect on other queues.
+//
+// On a bounded queue the first Add of an item waits for room, or fails with
+// ErrFull, as it would without debouncing. The room is not held while the
+// item waits though: an item which finds the queue full once ready is
+// dropped, unless the overflow policy lets it wait or evict.
+func WithDebounce[V any](quiet, maxDelay time.Duration, merge func(old, new V) V) Option {
+	return func(cfg *options) {
+		cfg.debounce = &debounceOptions{
+			quiet:    quiet,
+			maxDelay: maxDelay,
+			merge: func(old, new any) any {
+				if merge == nil {
+					return new
+				}
+				return merge(old.(V), new.(V))
+			},
+		}
+	}
+}
+
+// debounce adds value, or merges it into the queued value and pushes its
+// ready time back. A new value needs room in the main queue, which it waits
+// for when block is set.
+func (q *delayingQueue[V]) debounce(ctx context.Context, value V, block bool) error {
+	cfg := q.mainQueue.opts.debounce
+	if _, waiting := q.waitQueue.Get(newWaitFor[V](value)); !waiting {
+		if err := q.mainQueue.waitRoom(ctx, value, block); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+
+	q.waitQueue.cond.L.Lock()
+	item, waiting := q.waitQueue.heap.Get(newWaitFor[V](value))
+	switch {
+	case waiting:
+		// The waiting loop reads the items without the lock, so the
+		// item is replaced rather than modified.
+		merged := &waitFor[V]{
+			value:   cfg.merge(item.value, value).(V),
+			firstAt: item.firstAt,
+			readyAt: now.Add(cfg.quiet),
+		}
+		if cfg.maxDelay > 0 && merged.firstAt.Add(cfg.maxDelay).Before(merged.readyAt) {
+			merged.readyAt = merged.firstAt.Add(cfg.maxDelay)
+		}
+		q.waitQueue.heap.Add(merged)
+	case q.mainQueue.merge(value, cfg.merge):
+		// The item is ready already, it only takes the merged value.
+	default:
+		q.waitQueue.heap.Add(&waitFor[V]{value: value, firstAt: now, readyAt: now.Add(cfg.quiet)})
+		q.mainQueue.opts.metrics.DelayedAdd()
+	}
+	q.waitQueue.cond.L.Unlock()
+	q.waitQueue.cond.Broadcast()
+
+	select {
+	case q.wakeCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// merge merges value into the queued value of its key, including a value
+// deferred while its key is in flight. It reports whether there was one.
+func (que *blockQueue[V]) merge(value V, merge func(old, new any) any) bool {
+	que.cond.L.Lock()
+	defer que.cond.L.Unlock()
+	if que.stopping {
+		return false
+	}
+
+	if que.processing != nil {
+		key := que.constraint.FormStoreKey(value)
+		if dirty, ok := que.processing.dirty[key]; ok {
+			que.processing.dirty[key] = merge(dirty, value).(V)
+			return true
+		}
+	}
+	old, ok := que.heap.Get(value)
+	if !ok {
+		return false
+	}
+	que.heap.Add(merge(old, value).(V))
+	return true
+}
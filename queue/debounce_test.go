@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestDelayingQueue_Debounce(t *testing.T) {
+	convey.Convey("test debouncing delaying queue", t, func() {
+		queue := newDelayingQueue[*testItem](&testConstraint{},
+			WithDebounce(100*time.Millisecond, 300*time.Millisecond, func(old, new *testItem) *testItem {
+				return &testItem{key: new.key, value: old.value + new.value}
+			}))
+		defer queue.Shutdown()
+
+		convey.Convey("test updates coalesce once things settle", func() {
+			start := time.Now()
+			for i := 1; i <= 4; i++ {
+				queue.Add(&testItem{key: "Item_0", value: i})
+				time.Sleep(10 * time.Millisecond)
+			}
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+			_, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+
+			item, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.value, convey.ShouldEqual, 10)
+			convey.So(time.Since(start), convey.ShouldBeGreaterThanOrEqualTo, 130*time.Millisecond)
+		})
+
+		convey.Convey("test the max delay bounds a busy item", func() {
+			start := time.Now()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 25; i++ {
+					queue.Add(&testItem{key: "Item_0", value: 1})
+					time.Sleep(20 * time.Millisecond)
+				}
+			}()
+
+			item, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(time.Since(start), convey.ShouldBeLessThan, 450*time.Millisecond)
+			convey.So(item.value, convey.ShouldBeGreaterThan, 1)
+			<-done
+		})
+
+		convey.Convey("test ready items take the merged value", func() {
+			queue.Add(&testItem{key: "Item_0", value: 1})
+			eventually(func() bool { return queue.mainQueue.Len() == 1 })
+			queue.Add(&testItem{key: "Item_0", value: 2})
+
+			item, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(item.value, convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("test an item added after a delay is debounced from then on", func() {
+			queue.AddAfter(&testItem{key: "Item_0", value: 1}, 2*time.Second)
+			eventually(func() bool { return queue.waitQueue.Len() == 1 })
+			start := time.Now()
+			queue.Add(&testItem{key: "Item_0", value: 2})
+
+			waiting, ok := queue.waitQueue.Get(newWaitFor[*testItem](&testItem{key: "Item_0"}))
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(waiting.readyAt.After(start), convey.ShouldBeTrue)
+			convey.So(waiting.value.value, convey.ShouldEqual, 3)
+
+			item, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.value, convey.ShouldEqual, 3)
+		})
+	})
+}
+
+func TestDelayingQueue_DebounceCapacity(t *testing.T) {
+	convey.Convey("test debouncing a bounded delaying queue", t, func() {
+		queue := newDelayingQueue[*testItem](&testConstraint{},
+			WithCapacity(1, OverflowReject),
+			WithDebounce[*testItem](10*time.Millisecond, 0, nil))
+		defer queue.Shutdown()
+
+		convey.So(queue.TryAdd(&testItem{key: "Item_0", value: 1}), convey.ShouldBeNil)
+		eventually(func() bool { return queue.mainQueue.Len() == 1 })
+
+		convey.Convey("test new items are turned away while the queue is full", func() {
+			convey.So(queue.TryAdd(&testItem{key: "Item_1", value: 1}), convey.ShouldEqual, ErrFull)
+			convey.So(queue.AddContext(context.Background(), &testItem{key: "Item_1", value: 1}), convey.ShouldEqual, ErrFull)
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("test queued items still take updates", func() {
+			convey.So(queue.TryAdd(&testItem{key: "Item_0", value: 2}), convey.ShouldBeNil)
+			item, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(item.value, convey.ShouldEqual, 2)
+		})
+	})
+}
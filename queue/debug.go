@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+// Dump writes the layout of the main queue and the wait queue as indented
+// text trees. Items of the wait queue are annotated with their readyAt time.
+// A nil format falls back to fmt.Sprint.
+func (q *delayingQueue[V]) Dump(w io.Writer, format func(V) string) error {
+	if format == nil {
+		format = func(value V) string {
+			return fmt.Sprint(value)
+		}
+	}
+
+	mainNodes, err := heap.Snapshot[V](q.mainQueue.heap)
+	if err != nil {
+		return err
+	}
+	waitNodes, err := heap.Snapshot[*waitFor[V]](q.waitQueue.heap)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(w, "main queue (%d items):\n", len(mainNodes)); err != nil {
+		return err
+	}
+	if err = heap.WriteTree[V](w, mainNodes, format); err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(w, "wait queue (%d items):\n", len(waitNodes)); err != nil {
+		return err
+	}
+	now := time.Now()
+	return heap.WriteTree[*waitFor[V]](w, waitNodes, func(item *waitFor[V]) string {
+		return fmt.Sprintf("%s readyAt=%s (in %s)", format(item.value),
+			item.readyAt.Format(time.RFC3339Nano), item.readyAt.Sub(now).Round(time.Millisecond))
+	})
+}
+
+// upcoming returns the first n items of the wait queue by readyAt.
+func (q *delayingQueue[V]) upcoming(n int) []*waitFor[V] {
+	items := q.waitQueue.List()
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].readyAt.Before(items[j].readyAt)
+	})
+	if n < len(items) {
+		items = items[:n]
+	}
+	return items
+}
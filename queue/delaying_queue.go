@@ -1,14 +1,19 @@
 package queue
 
 import (
+	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type waitFor[V any] struct {
 	readyAt time.Time
+	// firstAt is when the item was first added, it bounds debouncing.
+	firstAt time.Time
 	value   V
 	index   int
 }
@@ -33,7 +38,13 @@ func (convertor *waitConstraintConvertor[V]) FormStoreKey(item *waitFor[V]) stri
 	return convertor.origin.FormStoreKey(item.value)
 }
 
+// Less orders the waiting items by readyAt, then by priority. The waiting loop
+// only looks at the head, so an item ordered by priority alone could hold the
+// items ready before it back until it gets ready itself.
 func (convertor *waitConstraintConvertor[V]) Less(itemI, itemJ *waitFor[V]) bool {
+	if !itemI.readyAt.Equal(itemJ.readyAt) {
+		return itemI.readyAt.Before(itemJ.readyAt)
+	}
 	return convertor.origin.Less(itemI.value, itemJ.value)
 }
 
@@ -46,32 +57,62 @@ type delayingQueue[V any] struct {
 	stopCh chan struct{}
 	// waitingForAddCh is a buffered channel that feeds waitingForAdd
 	waitingForAddCh chan *waitFor[V]
+	// wakeCh wakes the waiting loop up after the wait queue changed
+	wakeCh chan struct{}
+	// pending counts the delayed items neither in the wait queue nor in the
+	// main queue: being added, in waitingForAddCh or being promoted. It is
+	// guarded by the lock of the wait queue.
+	pending int
+	// sweepAt is when the waiting loop wakes up next, in Unix nanoseconds.
+	// It is math.MaxInt64 while the loop is busy or has nothing to wait for.
+	sweepAt int64
 
 	stopOnce sync.Once
 	stop     bool
+	// draining is set once a drain or discard shutdown started, new items
+	// are rejected from then on.
+	draining bool
+}
+
+func NewDelayingQueue[V any](constraint HeapConstraint[V], opts ...Option) DelayingQueue[V] {
+	return newDelayingQueue(constraint, opts...)
 }
 
-func NewDelayingQueue[V any](constraint HeapConstraint[V]) DelayingQueue[V] {
-	return newDelayingQueue(constraint)
+func newDelayingQueue[V any](constraint HeapConstraint[V], opts ...Option) *delayingQueue[V] {
+	return newDelayingQueueWith[V](constraint, newBlockQueue[V](constraint, opts...))
 }
 
-func newDelayingQueue[V any](constraint HeapConstraint[V]) *delayingQueue[V] {
+// newDelayingQueueWith builds a delaying queue around the given main queue.
+func newDelayingQueueWith[V any](constraint HeapConstraint[V], mainQueue *blockQueue[V]) *delayingQueue[V] {
 	dQueue := &delayingQueue[V]{
-		mainQueue: newBlockQueue[V](constraint),
-		waitQueue: newBlockQueue[*waitFor[V]](&waitConstraintConvertor[V]{origin: constraint}),
+		mainQueue: mainQueue,
+		waitQueue: newBlockQueue[*waitFor[V]](&waitConstraintConvertor[V]{origin: constraint},
+			withQueueMetrics(waitingMetrics{metrics: mainQueue.opts.metrics})),
 		heartbeat: time.NewTimer(maxWait),
+		sweepAt:   math.MaxInt64,
 
 		waitingForAddCh: make(chan *waitFor[V], 1000),
+		wakeCh:          make(chan struct{}, 1),
 		stopCh:          make(chan struct{}),
 	}
 
+	dQueue.watchWaiting()
 	go dQueue.waitingLoop()
 	return dQueue
 }
 
+// AddAfter adds the item once duration elapsed. Items added after Shutdown
+// are dropped; use AddAfterContext to be told about it.
 func (q *delayingQueue[V]) AddAfter(item V, duration time.Duration) {
-	if q.IsShutdown() {
-		return
+	_ = q.AddAfterContext(context.Background(), item, duration)
+}
+
+// AddAfterContext adds the item once duration elapsed. It fails with
+// ErrShutdown after Shutdown, or with ctx.Err() if ctx is done before the
+// item could be handed to the waiting loop.
+func (q *delayingQueue[V]) AddAfterContext(ctx context.Context, item V, duration time.Duration) error {
+	if err := q.enter(); err != nil {
+		return err
 	}
 
 	if _, ok := q.waitQueue.Get(newWaitFor[V](item)); ok {
@@ -80,28 +121,87 @@ func (q *delayingQueue[V]) AddAfter(item V, duration time.Duration) {
 
 	// immediately add things with no delay
 	if duration <= 0 {
-		q.mainQueue.Add(item)
-		return
+		defer q.leave()
+		return q.addReady(ctx, item, true)
 	}
 
+	now := time.Now()
 	select {
-	case _, ok := <-q.stopCh:
-		if !ok {
-			logrus.Errorf("unexpected closed")
-		}
-	case q.waitingForAddCh <- &waitFor[V]{value: item, readyAt: time.Now().Add(duration)}:
+	case <-q.stopCh:
+		q.leave()
+		return ErrShutdown
+	case <-ctx.Done():
+		q.leave()
+		return ctx.Err()
+	case q.waitingForAddCh <- &waitFor[V]{value: item, firstAt: now, readyAt: now.Add(duration)}:
+		// The waiting loop leaves once it received the item.
+		q.mainQueue.opts.metrics.DelayedAdd()
+		return nil
 	}
 }
 
+// Add adds or updates an item. Items added after Shutdown are dropped; use
+// AddContext or TryAdd to be told about it.
 func (q *delayingQueue[V]) Add(value V) {
+	_ = q.AddContext(context.Background(), value)
+}
+
+func (q *delayingQueue[V]) AddContext(ctx context.Context, value V) error {
+	if q.IsShutdown() {
+		return ErrShutdown
+	}
+	if q.mainQueue.opts.debounce != nil {
+		if err := q.enter(); err != nil {
+			return err
+		}
+		defer q.leave()
+		return q.debounce(ctx, value, true)
+	}
 	if item, ok := q.waitQueue.Get(newWaitFor[V](value)); ok {
 		item.value = value
-		return
+		return nil
 	}
-	q.mainQueue.Add(value)
+	return q.addReady(ctx, value, true)
+}
+
+func (q *delayingQueue[V]) TryAdd(value V) error {
+	if q.IsShutdown() {
+		return ErrShutdown
+	}
+	if q.mainQueue.opts.debounce != nil {
+		if err := q.enter(); err != nil {
+			return err
+		}
+		defer q.leave()
+		return q.debounce(context.Background(), value, false)
+	}
+	if item, ok := q.waitQueue.Get(newWaitFor[V](value)); ok {
+		item.value = value
+		return nil
+	}
+	return q.addReady(context.Background(), value, false)
+}
+
+// addReady adds value to the main queue, waking the waiting loop up when
+// value expires before the loop would sweep it.
+func (q *delayingQueue[V]) addReady(ctx context.Context, value V, block bool) error {
+	var err error
+	if block {
+		err = q.mainQueue.AddContext(ctx, value)
+	} else {
+		err = q.mainQueue.TryAdd(value)
+	}
+	if err == nil {
+		q.sweepSoon()
+	}
+	return err
 }
 
 func (q *delayingQueue[V]) Update(obj V) error {
+	if q.IsShutdown() {
+		return ErrShutdown
+	}
+
 	_, ok := q.waitQueue.Get(newWaitFor[V](obj))
 	if ok {
 		return q.waitQueue.Update(newWaitFor[V](obj))
@@ -111,6 +211,10 @@ func (q *delayingQueue[V]) Update(obj V) error {
 }
 
 func (q *delayingQueue[V]) Refresh(obj V) error {
+	if q.IsShutdown() {
+		return ErrShutdown
+	}
+
 	item, ok := q.waitQueue.Get(newWaitFor[V](obj))
 	if ok {
 		item.value = obj
@@ -121,6 +225,10 @@ func (q *delayingQueue[V]) Refresh(obj V) error {
 
 // Delete object from both main queue and wait queue.
 func (q *delayingQueue[V]) Delete(obj V) error {
+	if q.IsShutdown() {
+		return ErrShutdown
+	}
+
 	item, existInMain := q.mainQueue.Get(obj)
 	queItem, existInWait := q.waitQueue.Get(newWaitFor[V](obj))
 
@@ -169,6 +277,22 @@ func (q *delayingQueue[V]) Pop() (V, error) {
 	return q.mainQueue.Pop()
 }
 
+func (q *delayingQueue[V]) TryPop() (V, bool) {
+	return q.mainQueue.TryPop()
+}
+
+func (q *delayingQueue[V]) PopContext(ctx context.Context) (V, error) {
+	return q.mainQueue.PopContext(ctx)
+}
+
+func (q *delayingQueue[V]) PopTimeout(timeout time.Duration) (V, error) {
+	return q.mainQueue.PopTimeout(timeout)
+}
+
+func (q *delayingQueue[V]) PopN(n int) ([]V, error) {
+	return q.mainQueue.PopN(n)
+}
+
 func (q *delayingQueue[V]) Len() int {
 	return q.mainQueue.Len() + q.waitQueue.Len()
 }
@@ -196,15 +320,21 @@ func (q *delayingQueue[V]) waitingLoop() {
 	// Make a timer that expires when the item at the head of the waiting queue is ready
 	var nextReadyAtTimer *time.Timer
 
+	// room is set while the main queue is full and waits for room: the
+	// ready items stay in the wait queue until the main queue changed.
+	var room <-chan struct{}
+
 	for {
-		if q.IsShutdown() {
+		if q.isStopped() {
 			return
 		}
 
+		// Adds wake the loop up until it knows when to wake up next.
+		atomic.StoreInt64(&q.sweepAt, math.MaxInt64)
 		now := time.Now()
 
 		// Add ready entries
-		for q.waitQueue.Len() > 0 {
+		for room == nil && q.waitQueue.Len() > 0 {
 			entry, err := q.waitQueue.Peek()
 
 			if err != nil {
@@ -216,31 +346,55 @@ func (q *delayingQueue[V]) waitingLoop() {
 				break
 			}
 
-			item, err := q.waitQueue.Pop()
+			item, err := q.popWaiting()
 			if err != nil {
 				logrus.Errorf("pop from wait queue with error %v", err)
 				break
 			}
 
-			q.mainQueue.Add(item.value)
+			room, err = q.mainQueue.promote(item.value)
+			if room != nil {
+				q.putBack(item)
+			} else if err != nil && err != ErrShutdown {
+				logrus.Errorf("drop delayed item: %v", err)
+			}
+			q.leave()
+			if room != nil {
+				break
+			}
 		}
 
-		// Set up a wait for the first item's readyAt if one exists
-		nextReadyAt := never
-		if q.waitQueue.Len() > 0 {
-			if nextReadyAtTimer != nil {
-				nextReadyAtTimer.Stop()
-			}
+		// Drop the expired items and learn when the next one expires
+		next, wake := q.mainQueue.expire()
 
+		// Set up a wait for the first item's readyAt if one exists
+		if room == nil && q.waitQueue.Len() > 0 {
 			entry, err := q.waitQueue.Peek()
 			if err != nil {
 				logrus.Errorf("delaying queue get wrong type item due to %v", err)
+			} else if !wake || entry.readyAt.Before(next) {
+				next, wake = entry.readyAt, true
 			}
+		}
 
-			nextReadyAtTimer = time.NewTimer(entry.readyAt.Sub(now))
+		nextReadyAt := never
+		if wake {
+			if nextReadyAtTimer != nil {
+				nextReadyAtTimer.Stop()
+			}
+			nextReadyAtTimer = time.NewTimer(next.Sub(now))
 			nextReadyAt = nextReadyAtTimer.C
+			atomic.StoreInt64(&q.sweepAt, next.UnixNano())
 		}
 
+		if !q.heartbeat.Stop() {
+			select {
+			case <-q.heartbeat.C:
+			default:
+			}
+		}
+		q.heartbeat.Reset(maxWait)
+
 		select {
 		case <-q.stopCh:
 			return
@@ -251,6 +405,13 @@ func (q *delayingQueue[V]) waitingLoop() {
 		case <-nextReadyAt:
 			// continue the loop, which will add ready items
 
+		case <-q.wakeCh:
+			// continue the loop, which will wait for the new head
+
+		case <-room:
+			// continue the loop, which will try the ready items again
+			room = nil
+
 		case waitEntry := <-q.waitingForAddCh:
 			q.receiveItems(waitEntry)
 			q.drainChannel()
@@ -258,12 +419,62 @@ func (q *delayingQueue[V]) waitingLoop() {
 	}
 }
 
+// putBack returns an item the main queue had no room for to the wait queue,
+// unless it was added again meanwhile.
+func (q *delayingQueue[V]) putBack(item *waitFor[V]) {
+	q.waitQueue.cond.L.Lock()
+	if _, ok := q.waitQueue.heap.Get(item); !ok {
+		q.waitQueue.heap.Add(item)
+	}
+	q.waitQueue.cond.L.Unlock()
+	q.waitQueue.cond.Broadcast()
+}
+
 func (q *delayingQueue[V]) receiveItems(waitEntry *waitFor[V]) {
 	if waitEntry.readyAt.After(time.Now()) {
+		q.waitQueue.cond.L.Lock()
 		q.waitQueue.heap.Add(waitEntry)
+		q.pending--
+		q.waitQueue.cond.L.Unlock()
+		q.waitQueue.cond.Broadcast()
 	} else {
 		q.mainQueue.Add(waitEntry.value)
+		q.leave()
+	}
+}
+
+// enter counts a delayed item as pending, which a drain waits for. It fails
+// once the queue is shutting down; counting first makes sure that a drain
+// either waits for the item or the item is rejected.
+func (q *delayingQueue[V]) enter() error {
+	q.waitQueue.cond.L.Lock()
+	q.pending++
+	q.waitQueue.cond.L.Unlock()
+	if q.IsShutdown() {
+		q.leave()
+		return ErrShutdown
+	}
+	return nil
+}
+
+// leave ends what enter or popWaiting started.
+func (q *delayingQueue[V]) leave() {
+	q.waitQueue.cond.L.Lock()
+	q.pending--
+	q.waitQueue.cond.L.Unlock()
+	q.waitQueue.cond.Broadcast()
+}
+
+// popWaiting pops the head of the wait queue, which stays pending until it
+// was promoted.
+func (q *delayingQueue[V]) popWaiting() (*waitFor[V], error) {
+	q.waitQueue.cond.L.Lock()
+	defer q.waitQueue.cond.L.Unlock()
+	item, err := q.waitQueue.heap.Pop()
+	if err == nil {
+		q.pending++
 	}
+	return item, err
 }
 
 func (q *delayingQueue[V]) drainChannel() {
@@ -283,11 +494,26 @@ func (q *delayingQueue[V]) drainChannel() {
 }
 func (q *delayingQueue[V]) IsShutdown() bool {
 	q.lock.RLock()
-	shutting := q.stop
+	shutting := q.stop || q.draining
 	q.lock.RUnlock()
 	return shutting
 }
 
+func (q *delayingQueue[V]) isStopped() bool {
+	q.lock.RLock()
+	stopped := q.stop
+	q.lock.RUnlock()
+	return stopped
+}
+
 func (q *delayingQueue[V]) Peek() (V, error) {
 	return q.mainQueue.Peek()
 }
+
+func (q *delayingQueue[V]) PeekN(n int) []V {
+	return q.mainQueue.PeekN(n)
+}
+
+func (q *delayingQueue[V]) storeKey(value V) string {
+	return q.mainQueue.constraint.FormStoreKey(value)
+}
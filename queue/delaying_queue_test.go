@@ -1,7 +1,9 @@
 package queue
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -159,3 +161,149 @@ func TestDelayingQueue_DelayingQueueFunctions(t *testing.T) {
 		})
 	})
 }
+
+func TestDelayingQueue_ReadyOrder(t *testing.T) {
+	convey.Convey("test a delayed item gets ready on time behind a later one", t, func() {
+		queue := newDelayingQueue[*testItem](&testConstraint{})
+		defer queue.Shutdown()
+
+		// The first item has the higher priority but gets ready last.
+		queue.AddAfter(&testItem{key: "Item_0", value: 0}, 5*time.Second)
+		queue.AddAfter(&testItem{key: "Item_1", value: 1}, 10*time.Millisecond)
+
+		item, err := queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(item.key, convey.ShouldEqual, "Item_1")
+		convey.So(queue.Len(), convey.ShouldEqual, 1)
+	})
+}
+
+func TestDelayingQueue_Dump(t *testing.T) {
+	queue := newDelayingQueue[*testItem](&testConstraint{})
+	defer queue.Shutdown()
+
+	convey.Convey("test dump of main and wait queues", t, func() {
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		queue.Add(&testItem{key: "Item_1", value: 1})
+		queue.AddAfter(&testItem{key: "Item_2", value: 2}, time.Minute)
+		time.Sleep(10 * time.Millisecond)
+
+		var b strings.Builder
+		err := queue.Dump(&b, func(item *testItem) string {
+			return fmt.Sprint(item.value)
+		})
+		convey.So(err, convey.ShouldBeNil)
+		dump := b.String()
+		convey.So(dump, convey.ShouldContainSubstring, "main queue (2 items):\n[0] key=Item_0 value=0\n  [1] key=Item_1 value=1\n")
+		convey.So(dump, convey.ShouldContainSubstring, "wait queue (1 items):\n[0] key=Item_2 value=2 readyAt=")
+	})
+}
+
+func TestDelayingQueue_ShutdownModes(t *testing.T) {
+	convey.Convey("test drain and discard shutdowns", t, func() {
+		convey.Convey("test drain waits for delayed items", func() {
+			queue := newDelayingQueue[*testItem](&testConstraint{})
+			queue.Add(&testItem{key: "Item_0", value: 0})
+			queue.AddAfter(&testItem{key: "Item_1", value: 1}, 50*time.Millisecond)
+			time.Sleep(10 * time.Millisecond)
+
+			drained := make(chan error, 1)
+			go func() {
+				drained <- queue.ShutdownWithDrain(context.Background())
+			}()
+			time.Sleep(10 * time.Millisecond)
+			queue.AddAfter(&testItem{key: "Item_2", value: 2}, time.Millisecond)
+			convey.So(queue.TryAdd(&testItem{key: "Item_3", value: 3}), convey.ShouldNotBeNil)
+
+			for i := 0; i < 2; i++ {
+				item, err := queue.Pop()
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(item.value, convey.ShouldEqual, i)
+			}
+			convey.So(<-drained, convey.ShouldBeNil)
+			convey.So(queue.Len(), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test drain waits for items handed to a busy timer loop", func() {
+			busy := make(chan struct{})
+			release := make(chan struct{})
+			queue := newDelayingQueue[*testItem](&testTTLConstraint{},
+				WithOnExpire(func(*testItem) {
+					close(busy)
+					<-release
+				}))
+
+			// The timer loop calls OnExpire, which holds it up.
+			queue.Add(&testItem{key: "Item_10", value: 10})
+			<-busy
+			convey.So(queue.AddAfterContext(context.Background(), &testItem{key: "Item_60000", value: 60000}, time.Millisecond), convey.ShouldBeNil)
+
+			drained := make(chan error, 1)
+			go func() {
+				drained <- queue.ShutdownWithDrain(context.Background())
+			}()
+			select {
+			case <-drained:
+				t.Fatal("the drain did not wait for the delayed item")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			close(release)
+			item, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.key, convey.ShouldEqual, "Item_60000")
+			convey.So(<-drained, convey.ShouldBeNil)
+		})
+
+		convey.Convey("test discard", func() {
+			queue := newDelayingQueue[*testItem](&testConstraint{})
+			queue.Add(&testItem{key: "Item_0", value: 0})
+			queue.AddAfter(&testItem{key: "Item_1", value: 1}, time.Minute)
+			time.Sleep(10 * time.Millisecond)
+
+			items := queue.ShutdownWithDiscard()
+			convey.So(len(items), convey.ShouldEqual, 2)
+			convey.So(items[0].key, convey.ShouldEqual, "Item_0")
+			convey.So(items[1].key, convey.ShouldEqual, "Item_1")
+			_, err := queue.Pop()
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDelayingQueue_AfterShutdown(t *testing.T) {
+	queue := newDelayingQueue[*testItem](&testConstraint{})
+	queue.Add(&testItem{key: "Item_0", value: 0})
+	queue.AddAfter(&testItem{key: "Item_1", value: 1}, time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	queue.Shutdown()
+
+	convey.Convey("test operations after shutdown", t, func() {
+		convey.Convey("test mutations are rejected", func() {
+			item := &testItem{key: "Item_2", value: 2}
+			convey.So(queue.TryAdd(item), convey.ShouldEqual, ErrShutdown)
+			convey.So(queue.AddContext(context.Background(), item), convey.ShouldEqual, ErrShutdown)
+			convey.So(queue.AddAfterContext(context.Background(), item, time.Second), convey.ShouldEqual, ErrShutdown)
+			queue.Add(item)
+			queue.AddAfter(item, time.Second)
+			convey.So(queue.Len(), convey.ShouldEqual, 2)
+
+			for _, existing := range []*testItem{{key: "Item_0", value: 5}, {key: "Item_1", value: 5}} {
+				convey.So(queue.Update(existing), convey.ShouldEqual, ErrShutdown)
+				convey.So(queue.Refresh(existing), convey.ShouldEqual, ErrShutdown)
+				convey.So(queue.Delete(existing), convey.ShouldEqual, ErrShutdown)
+			}
+		})
+
+		convey.Convey("test reads remain valid", func() {
+			for _, key := range []string{"Item_0", "Item_1"} {
+				_, ok := queue.Get(&testItem{key: key})
+				convey.So(ok, convey.ShouldBeTrue)
+			}
+			convey.So(len(queue.List()), convey.ShouldEqual, 2)
+			head, err := queue.Peek()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(head.key, convey.ShouldEqual, "Item_0")
+		})
+	})
+}
@@ -0,0 +1,17 @@
+package queue
+
+import "errors"
+
+var (
+	// ErrTimeout is returned by the timed pops when no item became
+	// available in time.
+	ErrTimeout = errors.New("pop timed out")
+	// ErrFull is returned when an item can not be added to a full queue.
+	ErrFull = errors.New("queue is full")
+	// ErrShutdown is returned by every operation modifying a queue once it
+	// has been shut down, and by pops once the queue is stopped.
+	ErrShutdown = errors.New("queue is shut down")
+	// ErrInvalidAging is returned by NewAgingQueue for an aging policy
+	// whose interval is not positive.
+	ErrInvalidAging = errors.New("aging interval must be positive")
+)
@@ -0,0 +1,292 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+// NewFairQueue returns a BlockQueue sharing its pops fairly among tenants.
+// Every tenant, as returned by tenant for an item, keeps its items in its own
+// priority heap, and the tenants are served in proportion to their weight
+// with start-time fair queuing: each pop charges its tenant 1/weight of
+// virtual time, and the tenant with the lowest virtual time is served next.
+// A nil weight, or a weight which is not positive, counts as 1. A tenant
+// which ran out of items rejoins at the later of the current virtual time and
+// the end of its last turn, so it can neither save up turns nor skip paying
+// for the ones it took.
+func NewFairQueue[V any](constraint HeapConstraint[V], tenant func(V) string, weight func(tenant string) float64, opts ...Option) BlockQueue[V] {
+	return newFairQueue[V](constraint, tenant, weight, opts...)
+}
+
+func newFairQueue[V any](constraint HeapConstraint[V], tenant func(V) string, weight func(tenant string) float64, opts ...Option) *blockQueue[V] {
+	cfg := newOptions(opts)
+	return newBlockQueueWith[V](constraint, newFairHeap[V](constraint, tenant, weight, cfg), cfg)
+}
+
+type fairTenant[V any] struct {
+	name  string
+	items heap.Heap[V]
+	// start is the virtual time at which the tenant is served next.
+	start float64
+}
+
+type fairTenantOrder[V any] struct{}
+
+func (fairTenantOrder[V]) FormStoreKey(tenant *fairTenant[V]) string {
+	return tenant.name
+}
+
+func (fairTenantOrder[V]) Less(left, right *fairTenant[V]) bool {
+	if left.start != right.start {
+		return left.start < right.start
+	}
+	return left.name < right.name
+}
+
+// fairHeap is a heap.Heap popping the items of its tenants in turns.
+type fairHeap[V any] struct {
+	lock       sync.Mutex
+	constraint HeapConstraint[V]
+	tenantOf   func(V) string
+	weight     func(tenant string) float64
+	newItems   func() heap.Heap[V]
+
+	// active holds the tenants with items, by start time.
+	active heap.Heap[*fairTenant[V]]
+	// tenants maps the keys of the items to their tenant.
+	tenants map[string]*fairTenant[V]
+	// idle keeps the start of the next turn of the tenants without items,
+	// until the virtual time reaches it.
+	idle      map[string]float64
+	idleSwept int
+	now       float64
+	length    int
+}
+
+func newFairHeap[V any](constraint HeapConstraint[V], tenant func(V) string, weight func(tenant string) float64, cfg options) *fairHeap[V] {
+	return &fairHeap[V]{
+		constraint: constraint,
+		tenantOf:   tenant,
+		weight:     weight,
+		newItems: func() heap.Heap[V] {
+			return newItemHeap[V](constraint, cfg)
+		},
+		active:  heap.New[string, *fairTenant[V]](fairTenantOrder[V]{}),
+		tenants: make(map[string]*fairTenant[V]),
+		idle:    make(map[string]float64),
+	}
+}
+
+func (h *fairHeap[V]) Add(value V) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := h.constraint.FormStoreKey(value)
+	name := h.tenantOf(value)
+	if tenant, ok := h.tenants[key]; ok {
+		if tenant.name == name {
+			tenant.items.Add(value)
+			return
+		}
+		// The item moved to another tenant.
+		h.deleteLocked(tenant, value)
+	}
+
+	tenant, ok := h.active.Get(&fairTenant[V]{name: name})
+	if !ok {
+		start := h.now
+		if next, ok := h.idle[name]; ok {
+			delete(h.idle, name)
+			if next > start {
+				start = next
+			}
+		}
+		tenant = &fairTenant[V]{name: name, items: h.newItems(), start: start}
+		h.active.Add(tenant)
+	}
+	tenant.items.Add(value)
+	h.tenants[key] = tenant
+	h.length++
+}
+
+func (h *fairHeap[V]) Delete(value V) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	tenant, ok := h.tenants[h.constraint.FormStoreKey(value)]
+	if !ok {
+		return fmt.Errorf("can not find item: %v in fair heap", value)
+	}
+	return h.deleteLocked(tenant, value)
+}
+
+func (h *fairHeap[V]) deleteLocked(tenant *fairTenant[V], value V) error {
+	if err := tenant.items.Delete(value); err != nil {
+		return err
+	}
+	delete(h.tenants, h.constraint.FormStoreKey(value))
+	h.length--
+	if tenant.items.Len() == 0 {
+		h.idleLocked(tenant)
+	}
+	return nil
+}
+
+// idleLocked removes a tenant without items from the active ones, keeping
+// the start of its next turn.
+func (h *fairHeap[V]) idleLocked(tenant *fairTenant[V]) {
+	_ = h.active.Delete(tenant)
+	h.idle[tenant.name] = tenant.start
+
+	// Tenants whose next turn is not ahead of the virtual time rejoin at
+	// the virtual time anyway, they are forgotten once in a while.
+	if len(h.idle) > 2*h.idleSwept+16 {
+		for name, next := range h.idle {
+			if next <= h.now {
+				delete(h.idle, name)
+			}
+		}
+		h.idleSwept = len(h.idle)
+	}
+}
+
+func (h *fairHeap[V]) Peek() (V, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	tenant, err := h.active.Peek()
+	if err != nil {
+		return *new(V), err
+	}
+	return tenant.items.Peek()
+}
+
+func (h *fairHeap[V]) Pop() (V, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.popLocked()
+}
+
+func (h *fairHeap[V]) popLocked() (V, error) {
+	tenant, err := h.active.Peek()
+	if err != nil {
+		return *new(V), err
+	}
+	value, err := tenant.items.Pop()
+	if err != nil {
+		return value, err
+	}
+	delete(h.tenants, h.constraint.FormStoreKey(value))
+	h.length--
+
+	h.now = tenant.start
+	tenant.start += 1 / h.weightOf(tenant.name)
+	if tenant.items.Len() == 0 {
+		h.idleLocked(tenant)
+		return value, nil
+	}
+	h.active.Add(tenant)
+	return value, nil
+}
+
+func (h *fairHeap[V]) PopN(n int) []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	values := make([]V, 0, h.capacityLocked(n))
+	for len(values) < n {
+		value, err := h.popLocked()
+		if err != nil {
+			break
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// PeekN returns the next n items in the order Pop would return them.
+func (h *fairHeap[V]) PeekN(n int) []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if n <= 0 {
+		return []V{}
+	}
+
+	type turn struct {
+		name  string
+		start float64
+		items []V
+	}
+	var turns []*turn
+	for _, tenant := range h.active.PeekN(h.active.Len()) {
+		turns = append(turns, &turn{name: tenant.name, start: tenant.start, items: tenant.items.PeekN(n)})
+	}
+
+	values := make([]V, 0, h.capacityLocked(n))
+	for len(values) < n {
+		var next *turn
+		for _, t := range turns {
+			if len(t.items) > 0 && (next == nil || t.start < next.start || t.start == next.start && t.name < next.name) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		values = append(values, next.items[0])
+		next.items = next.items[1:]
+		next.start += 1 / h.weightOf(next.name)
+	}
+	return values
+}
+
+func (h *fairHeap[V]) Get(value V) (V, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	tenant, ok := h.tenants[h.constraint.FormStoreKey(value)]
+	if !ok {
+		return *new(V), false
+	}
+	return tenant.items.Get(value)
+}
+
+func (h *fairHeap[V]) List() []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	list := make([]V, 0, h.length)
+	for _, tenant := range h.active.List() {
+		list = append(list, tenant.items.List()...)
+	}
+	return list
+}
+
+func (h *fairHeap[V]) Len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.length
+}
+
+func (h *fairHeap[V]) weightOf(tenant string) float64 {
+	if h.weight == nil {
+		return 1
+	}
+	if weight := h.weight(tenant); weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// capacityLocked returns the size of the slice holding n items at most.
+func (h *fairHeap[V]) capacityLocked(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n < h.length {
+		return n
+	}
+	return h.length
+}
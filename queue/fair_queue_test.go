@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func testTenant(item *testItem) string {
+	return strings.SplitN(item.key, "_", 2)[0]
+}
+
+func TestFairQueue(t *testing.T) {
+	convey.Convey("test fair queue", t, func() {
+		queue := newFairQueue[*testItem](&testConstraint{}, testTenant, func(tenant string) float64 {
+			if tenant == "a" {
+				return 2
+			}
+			return 1
+		})
+
+		convey.Convey("test a noisy tenant can not starve the others", func() {
+			for i := 0; i < 100; i++ {
+				queue.Add(&testItem{key: fmt.Sprintf("a_%d", i), value: i})
+			}
+			queue.Add(&testItem{key: "b_0", value: 1000})
+
+			items, err := queue.PopN(2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(items[0].key, convey.ShouldEqual, "a_0")
+			convey.So(items[1].key, convey.ShouldEqual, "b_0")
+			convey.So(queue.Len(), convey.ShouldEqual, 99)
+		})
+
+		convey.Convey("test tenants are served by weight and by priority", func() {
+			for i := 0; i < 6; i++ {
+				queue.Add(&testItem{key: fmt.Sprintf("a_%d", i), value: 10 - i})
+				queue.Add(&testItem{key: fmt.Sprintf("b_%d", i), value: i})
+			}
+			peeked := queue.PeekN(6)
+			items, err := queue.PopN(6)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(items, convey.ShouldResemble, peeked)
+
+			served := map[string]int{}
+			for _, item := range items {
+				served[testTenant(item)]++
+			}
+			convey.So(served["a"], convey.ShouldEqual, 4)
+			convey.So(served["b"], convey.ShouldEqual, 2)
+			convey.So(items[0].key, convey.ShouldEqual, "a_5")
+			convey.So(items[1].key, convey.ShouldEqual, "b_0")
+		})
+
+		convey.Convey("test a tenant refilling one item at a time can not starve the others", func() {
+			for i := 0; i < 50; i++ {
+				queue.Add(&testItem{key: fmt.Sprintf("b_%d", i), value: i})
+			}
+			queue.Add(&testItem{key: "c_0", value: 0})
+
+			served := map[string]int{}
+			for i := 0; i < 30; i++ {
+				item, err := queue.Pop()
+				convey.So(err, convey.ShouldBeNil)
+				served[testTenant(item)]++
+				if testTenant(item) == "c" {
+					queue.Add(&testItem{key: fmt.Sprintf("c_%d", i+1), value: 0})
+				}
+			}
+			convey.So(served["b"], convey.ShouldEqual, 15)
+			convey.So(served["c"], convey.ShouldEqual, 15)
+		})
+
+		convey.Convey("test taking no items", func() {
+			queue.Add(&testItem{key: "a_0", value: 1})
+			convey.So(queue.PeekN(-1), convey.ShouldBeEmpty)
+			convey.So(queue.PeekN(0), convey.ShouldBeEmpty)
+			items, err := queue.PopN(-1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(items, convey.ShouldBeEmpty)
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("test updating and deleting items", func() {
+			queue.Add(&testItem{key: "a_0", value: 1})
+			queue.Add(&testItem{key: "b_0", value: 2})
+			convey.So(queue.Update(&testItem{key: "a_0", value: 3}), convey.ShouldBeNil)
+			item, ok := queue.Get(&testItem{key: "a_0"})
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(item.value, convey.ShouldEqual, 3)
+
+			convey.So(queue.Delete(&testItem{key: "a_0"}), convey.ShouldBeNil)
+			convey.So(queue.Delete(&testItem{key: "a_0"}), convey.ShouldNotBeNil)
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+
+			item, err := queue.Pop()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.key, convey.ShouldEqual, "b_0")
+			_, ok = queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultTop is the number of items listed per queue by the debug handler.
+const defaultTop = 10
+
+// ServeHTTP lists the registered queues as JSON, with the number of items per
+// queue set by the top query parameter. Requests to a path ending in
+// /metrics get the OpenMetrics exposition instead.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if strings.HasSuffix(req.URL.Path, "/metrics") {
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+		_ = r.WriteOpenMetrics(w)
+		return
+	}
+
+	top := defaultTop
+	if raw := req.URL.Query().Get("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid top: %q", raw), http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(r.Inspect(top))
+}
+
+// ListenAndServe serves the registry on addr until ctx is done. The debug
+// endpoint exposes the items of the queues, so addr must be a loopback
+// address such as "localhost:6060".
+func (r *Registry) ListenAndServe(ctx context.Context, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("debug endpoint must listen on localhost, got %q", addr)
+	}
+
+	server := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	if err = server.ListenAndServe(); err == http.ErrServerClosed {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	queue := newDelayingQueue[*testItem](&testConstraint{}, WithMetrics("jobs", registry))
+	defer queue.Shutdown()
+	Register[*testItem](registry, "jobs", queue, func(item *testItem) string {
+		return item.key
+	})
+
+	queue.Add(&testItem{key: "Item_1", value: 1})
+	queue.Add(&testItem{key: "Item_0", value: 0})
+	queue.Add(&testItem{key: "Item_2", value: 2})
+	queue.AddAfter(&testItem{key: "Item_4", value: 4}, 2*time.Hour)
+	queue.AddAfter(&testItem{key: "Item_3", value: 3}, time.Hour)
+	// The delayed items reach the wait queue asynchronously.
+	eventually(func() bool { return queue.waitQueue.Len() == 2 })
+
+	convey.Convey("test the debug handler", t, func() {
+		convey.Convey("test listing the queues", func() {
+			recorder := httptest.NewRecorder()
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/queues?top=2", nil))
+			convey.So(recorder.Code, convey.ShouldEqual, http.StatusOK)
+
+			var infos []QueueInfo
+			convey.So(json.Unmarshal(recorder.Body.Bytes(), &infos), convey.ShouldBeNil)
+			convey.So(len(infos), convey.ShouldEqual, 1)
+			convey.So(infos[0].Name, convey.ShouldEqual, "jobs")
+			convey.So(infos[0].Len, convey.ShouldEqual, 5)
+			convey.So(infos[0].Top, convey.ShouldResemble, []string{"Item_0", "Item_1"})
+			convey.So(len(infos[0].Upcoming), convey.ShouldEqual, 2)
+			convey.So(infos[0].Upcoming[0].Item, convey.ShouldEqual, "Item_3")
+			convey.So(infos[0].Upcoming[1].Item, convey.ShouldEqual, "Item_4")
+			convey.So(infos[0].Stats.Depth, convey.ShouldEqual, 3)
+			convey.So(infos[0].Stats.Waiting, convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("test the openmetrics exposition", func() {
+			recorder := httptest.NewRecorder()
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/queues/metrics", nil))
+			convey.So(recorder.Header().Get("Content-Type"), convey.ShouldEqual, OpenMetricsContentType)
+
+			body := recorder.Body.String()
+			convey.So(body, convey.ShouldContainSubstring, "# TYPE queue_adds counter\n")
+			convey.So(body, convey.ShouldContainSubstring, "queue_adds_total{queue=\"jobs\"} 3\n")
+			convey.So(body, convey.ShouldContainSubstring, "queue_waiting{queue=\"jobs\"} 2\n")
+			convey.So(body, convey.ShouldContainSubstring, "queue_delayed_adds_total{queue=\"jobs\"} 2\n")
+			convey.So(strings.HasSuffix(body, "# EOF\n"), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("test invalid requests", func() {
+			recorder := httptest.NewRecorder()
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?top=x", nil))
+			convey.So(recorder.Code, convey.ShouldEqual, http.StatusBadRequest)
+
+			recorder = httptest.NewRecorder()
+			registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+			convey.So(recorder.Code, convey.ShouldEqual, http.StatusMethodNotAllowed)
+		})
+
+		convey.Convey("test listening on a public address is refused", func() {
+			err := registry.ListenAndServe(context.Background(), "0.0.0.0:0")
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
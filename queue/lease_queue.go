@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Lease is handed out with an item by PopLease. The item is invisible to
+// other consumers until the lease is acked, nacked or expires, in which case
+// the item is put back in the queue.
+type Lease[V any] struct {
+	ID       string
+	Value    V
+	Deadline time.Time
+}
+
+// leaseExpiry schedules the expiry of a lease in the expiries queue.
+type leaseExpiry struct {
+	key      string
+	id       string
+	deadline time.Time
+}
+
+type expiryConstraint struct{}
+
+func (expiryConstraint) FormStoreKey(expiry *leaseExpiry) string {
+	return expiry.key
+}
+
+func (expiryConstraint) Less(left, right *leaseExpiry) bool {
+	return left.deadline.Before(right.deadline)
+}
+
+type leaseQueue[V any] struct {
+	*delayingQueue[V]
+	constraint HeapConstraint[V]
+	visibility time.Duration
+
+	lock   sync.Mutex
+	leases map[string]*Lease[V]
+	nextID uint64
+	// expiries pops the leases once their deadline passed.
+	expiries *delayingQueue[*leaseExpiry]
+}
+
+// NewLeaseQueue returns a DelayingQueue handing out leased items. A lease
+// lasts visibility unless it is extended. Items popped without a lease, with
+// Pop or TryPop for instance, must be completed with Done.
+func NewLeaseQueue[V any](constraint HeapConstraint[V], visibility time.Duration, opts ...Option) LeaseQueue[V] {
+	return newLeaseQueue[V](constraint, visibility, opts...)
+}
+
+func newLeaseQueue[V any](constraint HeapConstraint[V], visibility time.Duration, opts ...Option) *leaseQueue[V] {
+	q := &leaseQueue[V]{
+		delayingQueue: newDelayingQueueWith[V](constraint, newWorkQueue[V](constraint, opts...)),
+		constraint:    constraint,
+		visibility:    visibility,
+		leases:        make(map[string]*Lease[V]),
+		expiries:      newDelayingQueue[*leaseExpiry](expiryConstraint{}),
+	}
+	go q.expiryLoop()
+	return q
+}
+
+// PopLease blocks until an item is available and leases it.
+func (q *leaseQueue[V]) PopLease() (Lease[V], error) {
+	return q.PopLeaseContext(context.Background())
+}
+
+// PopLeaseContext blocks until an item is available and leases it, or gives
+// up with ctx.Err() once ctx is done.
+func (q *leaseQueue[V]) PopLeaseContext(ctx context.Context) (Lease[V], error) {
+	item, err := q.mainQueue.PopContext(ctx)
+	if err != nil {
+		return Lease[V]{}, err
+	}
+
+	key := q.constraint.FormStoreKey(item)
+	q.lock.Lock()
+	q.nextID++
+	lease := &Lease[V]{
+		ID:       fmt.Sprintf("%s#%d", key, q.nextID),
+		Value:    item,
+		Deadline: time.Now().Add(q.visibility),
+	}
+	q.leases[key] = lease
+	q.expiries.AddAfter(&leaseExpiry{key: key, id: lease.ID, deadline: lease.Deadline}, q.visibility)
+	q.lock.Unlock()
+	return *lease, nil
+}
+
+// Ack completes the processing of a leased item and removes it for good.
+func (q *leaseQueue[V]) Ack(lease Lease[V]) error {
+	if err := q.endLease(lease); err != nil {
+		return err
+	}
+	q.mainQueue.release(lease.Value, false)
+	return nil
+}
+
+// Nack gives a leased item back, immediately or after delay. An item added
+// again while it was leased is requeued at once instead.
+func (q *leaseQueue[V]) Nack(lease Lease[V], delay time.Duration) error {
+	if err := q.endLease(lease); err != nil {
+		return err
+	}
+
+	if delay <= 0 {
+		q.mainQueue.release(lease.Value, true)
+		return nil
+	}
+	if q.mainQueue.release(lease.Value, false) {
+		return nil
+	}
+	if err := q.AddAfterContext(context.Background(), lease.Value, delay); err != nil {
+		// The queue is shutting down, keep the item for the drain.
+		q.mainQueue.requeue(lease.Value)
+	}
+	return nil
+}
+
+// Extend pushes the deadline of a lease back to duration from now.
+func (q *leaseQueue[V]) Extend(lease Lease[V], duration time.Duration) (Lease[V], error) {
+	key := q.constraint.FormStoreKey(lease.Value)
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	current, ok := q.leases[key]
+	if !ok || current.ID != lease.ID {
+		return Lease[V]{}, fmt.Errorf("lease %s is not held", lease.ID)
+	}
+
+	current.Deadline = time.Now().Add(duration)
+	q.expiries.AddAfter(&leaseExpiry{key: key, id: current.ID, deadline: current.Deadline}, duration)
+	return *current, nil
+}
+
+// Done completes an item popped without a lease.
+func (q *leaseQueue[V]) Done(value V) {
+	q.done(value)
+}
+
+func (q *leaseQueue[V]) done(value V) bool {
+	return q.mainQueue.done(value)
+}
+
+// endLease drops the lease if it is still held.
+func (q *leaseQueue[V]) endLease(lease Lease[V]) error {
+	key := q.constraint.FormStoreKey(lease.Value)
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	current, ok := q.leases[key]
+	if !ok || current.ID != lease.ID {
+		return fmt.Errorf("lease %s is not held", lease.ID)
+	}
+
+	delete(q.leases, key)
+	_ = q.expiries.Delete(&leaseExpiry{key: key})
+	return nil
+}
+
+// expiryLoop puts back the items whose lease expired.
+func (q *leaseQueue[V]) expiryLoop() {
+	for {
+		expiry, err := q.expiries.Pop()
+		if err != nil {
+			return
+		}
+
+		// An expiry popped before the lease was extended is stale, the
+		// lease keeps its ID but not its deadline.
+		q.lock.Lock()
+		lease, ok := q.leases[expiry.key]
+		expired := ok && lease.ID == expiry.id && lease.Deadline.Equal(expiry.deadline)
+		if expired {
+			delete(q.leases, expiry.key)
+		}
+		q.lock.Unlock()
+
+		if expired {
+			q.mainQueue.requeue(lease.Value)
+		}
+	}
+}
+
+func (q *leaseQueue[V]) Shutdown() {
+	q.delayingQueue.Shutdown()
+	q.expiries.Shutdown()
+}
+
+// ShutdownWithDrain drains the queue like DelayingQueue.ShutdownWithDrain;
+// leased items count as in flight until they are acked, and expired leases
+// are served again during the drain.
+func (q *leaseQueue[V]) ShutdownWithDrain(ctx context.Context) error {
+	defer q.expiries.Shutdown()
+	return q.delayingQueue.ShutdownWithDrain(ctx)
+}
+
+func (q *leaseQueue[V]) ShutdownWithDiscard() []V {
+	defer q.expiries.Shutdown()
+	return q.delayingQueue.ShutdownWithDiscard()
+}
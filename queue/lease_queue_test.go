@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestLeaseQueue(t *testing.T) {
+	queue := newLeaseQueue[*testItem](&testConstraint{}, 100*time.Millisecond)
+	defer queue.Shutdown()
+
+	convey.Convey("test leased pops", t, func() {
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		lease, err := queue.PopLease()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(lease.Value.key, convey.ShouldEqual, "Item_0")
+		convey.So(lease.Deadline.After(time.Now()), convey.ShouldBeTrue)
+
+		convey.Convey("test ack removes the item", func() {
+			convey.So(queue.Ack(lease), convey.ShouldBeNil)
+			convey.So(queue.Ack(lease), convey.ShouldNotBeNil)
+			time.Sleep(150 * time.Millisecond)
+			convey.So(queue.Len(), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test nack requeues the item", func() {
+			convey.So(queue.Nack(lease, 0), convey.ShouldBeNil)
+			again, err := queue.PopLease()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(again.Value.key, convey.ShouldEqual, "Item_0")
+			convey.So(again.ID, convey.ShouldNotEqual, lease.ID)
+
+			convey.So(queue.Nack(again, 50*time.Millisecond), convey.ShouldBeNil)
+			_, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+			last, err := queue.PopLeaseContext(context.Background())
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(queue.Ack(last), convey.ShouldBeNil)
+		})
+
+		convey.Convey("test expired lease is requeued", func() {
+			again, err := queue.PopLease()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(again.Value.key, convey.ShouldEqual, "Item_0")
+			convey.So(queue.Ack(lease), convey.ShouldNotBeNil)
+			convey.So(queue.Ack(again), convey.ShouldBeNil)
+		})
+
+		convey.Convey("test extend keeps the item leased", func() {
+			extended, err := queue.Extend(lease, 300*time.Millisecond)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(extended.Deadline.After(lease.Deadline), convey.ShouldBeTrue)
+
+			time.Sleep(150 * time.Millisecond)
+			_, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(queue.Ack(extended), convey.ShouldBeNil)
+		})
+
+		convey.Convey("test an expiry racing with extend is ignored", func() {
+			extended, err := queue.Extend(lease, 300*time.Millisecond)
+			convey.So(err, convey.ShouldBeNil)
+
+			// The expiry loop may have popped the expiry of the lease
+			// right before it was extended.
+			stale := &leaseExpiry{key: "Item_0", id: lease.ID, deadline: lease.Deadline}
+			convey.So(queue.expiries.mainQueue.TryAdd(stale), convey.ShouldBeNil)
+			eventually(func() bool { return queue.expiries.mainQueue.Len() == 0 })
+			time.Sleep(20 * time.Millisecond)
+
+			_, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(queue.Ack(extended), convey.ShouldBeNil)
+		})
+	})
+}
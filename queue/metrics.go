@@ -0,0 +1,222 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+// QueueMetrics receives the measurements of a single queue. The calls are
+// made while the queue is locked and must not block.
+type QueueMetrics interface {
+	// Depth is the number of items ready to be popped.
+	Depth(depth int)
+	Add()
+	Pop()
+	Update()
+	Delete()
+	// Latency is the time an item spent in the queue from its first add to
+	// its pop. Delayed items are counted from the time they became ready.
+	Latency(latency time.Duration)
+	// Waiting is the number of delayed items not ready yet.
+	Waiting(size int)
+	DelayedAdd()
+	Retry()
+	Expire()
+	// Oldest is when the oldest ready item was added, the zero time when
+	// there is none. Its age is up to the metrics, as of when they are read.
+	Oldest(at time.Time)
+}
+
+// MetricsProvider creates the metrics of the queues by name.
+type MetricsProvider interface {
+	NewQueueMetrics(name string) QueueMetrics
+}
+
+// WithMetrics reports the measurements of the queue to the metrics created by
+// provider for name.
+func WithMetrics(name string, provider MetricsProvider) Option {
+	return func(cfg *options) {
+		cfg.metrics = provider.NewQueueMetrics(name)
+	}
+}
+
+// withQueueMetrics reports to metrics directly, for the internal queues.
+func withQueueMetrics(metrics QueueMetrics) Option {
+	return func(cfg *options) {
+		cfg.metrics = metrics
+	}
+}
+
+// NoopMetricsProvider discards every measurement. It is the default.
+type NoopMetricsProvider struct{}
+
+func (NoopMetricsProvider) NewQueueMetrics(string) QueueMetrics {
+	return noopMetrics{}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) Depth(int)             {}
+func (noopMetrics) Add()                  {}
+func (noopMetrics) Pop()                  {}
+func (noopMetrics) Update()               {}
+func (noopMetrics) Delete()               {}
+func (noopMetrics) Latency(time.Duration) {}
+func (noopMetrics) Waiting(int)           {}
+func (noopMetrics) DelayedAdd()           {}
+func (noopMetrics) Retry()                {}
+func (noopMetrics) Expire()               {}
+func (noopMetrics) Oldest(time.Time)      {}
+
+// waitingMetrics reports the depth of the wait queue of a delaying queue as
+// the waiting size of its main queue, and drops the rest.
+type waitingMetrics struct {
+	noopMetrics
+	metrics QueueMetrics
+}
+
+func (m waitingMetrics) Depth(depth int) {
+	m.metrics.Waiting(depth)
+}
+
+type enqueued struct {
+	key string
+	at  time.Time
+}
+
+type enqueuedOrder struct{}
+
+func (enqueuedOrder) FormStoreKey(e *enqueued) string {
+	return e.key
+}
+
+func (enqueuedOrder) Less(left, right *enqueued) bool {
+	return left.at.Before(right.at)
+}
+
+// trackedHeap decorates the heap of a queue: it records when every key was
+// first added and reports the changes to the queue metrics. Its mutations
+// must be called with the queue lock held.
+type trackedHeap[V any] struct {
+	heap.Heap[V]
+	constraint HeapConstraint[V]
+	metrics    QueueMetrics
+	enqueued   heap.Heap[*enqueued]
+	// emit reports the changes to the watchers. The keys in promotions are
+	// being promoted from the wait queue of a delaying queue.
+	emit       func(t EventType, value V)
+	promotions map[string]struct{}
+	// ttl and deadlines are only set for queues with a TTL.
+	ttl       func(V) time.Duration
+	deadlines heap.Heap[*deadline[V]]
+}
+
+func newTrackedHeap[V any](inner heap.Heap[V], constraint HeapConstraint[V], metrics QueueMetrics) *trackedHeap[V] {
+	return &trackedHeap[V]{
+		Heap:       inner,
+		constraint: constraint,
+		metrics:    metrics,
+		enqueued:   heap.New[string, *enqueued](enqueuedOrder{}),
+		emit:       func(EventType, V) {},
+		promotions: make(map[string]struct{}),
+	}
+}
+
+func (h *trackedHeap[V]) Add(value V) {
+	key := h.constraint.FormStoreKey(value)
+	_, exists := h.enqueued.Get(&enqueued{key: key})
+	if exists {
+		h.metrics.Update()
+	} else {
+		h.enqueued.Add(&enqueued{key: key, at: time.Now()})
+		h.metrics.Add()
+	}
+	h.trackDeadline(key, value, !exists)
+	h.Heap.Add(value)
+	h.report()
+
+	switch _, promoted := h.promotions[key]; {
+	case promoted:
+		delete(h.promotions, key)
+		h.emit(EventPromoted, value)
+	case exists:
+		h.emit(EventUpdated, value)
+	default:
+		h.emit(EventAdded, value)
+	}
+}
+
+func (h *trackedHeap[V]) Delete(value V) error {
+	if err := h.Heap.Delete(value); err != nil {
+		return err
+	}
+	key := h.constraint.FormStoreKey(value)
+	_ = h.enqueued.Delete(&enqueued{key: key})
+	h.untrackDeadline(key)
+	h.metrics.Delete()
+	h.report()
+	h.emit(EventDeleted, value)
+	return nil
+}
+
+func (h *trackedHeap[V]) Pop() (V, error) {
+	value, err := h.Heap.Pop()
+	if err != nil {
+		return value, err
+	}
+	h.popped(value)
+	h.report()
+	return value, nil
+}
+
+func (h *trackedHeap[V]) PopN(n int) []V {
+	values := h.Heap.PopN(n)
+	for _, value := range values {
+		h.popped(value)
+	}
+	if len(values) > 0 {
+		h.report()
+	}
+	return values
+}
+
+// Snapshot exposes the layout of the decorated heap.
+func (h *trackedHeap[V]) Snapshot() []heap.Node[V] {
+	nodes, _ := heap.Snapshot[V](h.Heap)
+	return nodes
+}
+
+// enqueuedAt returns when the item with key was first added.
+func (h *trackedHeap[V]) enqueuedAt(key string) (time.Time, bool) {
+	e, ok := h.enqueued.Get(&enqueued{key: key})
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.at, true
+}
+
+// oldest returns when the oldest item was added to the heap.
+func (h *trackedHeap[V]) oldest() time.Time {
+	oldest, err := h.enqueued.Peek()
+	if err != nil {
+		return time.Time{}
+	}
+	return oldest.at
+}
+
+func (h *trackedHeap[V]) popped(value V) {
+	key := h.constraint.FormStoreKey(value)
+	if e, ok := h.enqueued.Get(&enqueued{key: key}); ok {
+		h.metrics.Latency(time.Since(e.at))
+		_ = h.enqueued.Delete(e)
+	}
+	h.untrackDeadline(key)
+	h.metrics.Pop()
+	h.emit(EventPopped, value)
+}
+
+func (h *trackedHeap[V]) report() {
+	h.metrics.Depth(h.Heap.Len())
+	h.metrics.Oldest(h.oldest())
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricsSnapshot is the state of an InMemoryMetrics. OldestAge is computed
+// when the snapshot is taken.
+type MetricsSnapshot struct {
+	Depth       int
+	Adds        uint64
+	Pops        uint64
+	Updates     uint64
+	Deletes     uint64
+	DelayedAdds uint64
+	Retries     uint64
+	Expired     uint64
+	Waiting     int
+	OldestAge   time.Duration
+
+	// LatencyCount, LatencySum and LatencyMax summarize the time from add
+	// to pop.
+	LatencyCount uint64
+	LatencySum   time.Duration
+	LatencyMax   time.Duration
+}
+
+// InMemoryMetrics keeps the measurements of a queue in memory.
+type InMemoryMetrics struct {
+	lock     sync.Mutex
+	snapshot MetricsSnapshot
+	oldest   time.Time
+}
+
+// Snapshot returns a copy of the measurements.
+func (m *InMemoryMetrics) Snapshot() MetricsSnapshot {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	snapshot := m.snapshot
+	if !m.oldest.IsZero() {
+		snapshot.OldestAge = time.Since(m.oldest)
+	}
+	return snapshot
+}
+
+func (m *InMemoryMetrics) update(f func(s *MetricsSnapshot)) {
+	m.lock.Lock()
+	f(&m.snapshot)
+	m.lock.Unlock()
+}
+
+func (m *InMemoryMetrics) Depth(depth int) {
+	m.update(func(s *MetricsSnapshot) { s.Depth = depth })
+}
+
+func (m *InMemoryMetrics) Add() {
+	m.update(func(s *MetricsSnapshot) { s.Adds++ })
+}
+
+func (m *InMemoryMetrics) Pop() {
+	m.update(func(s *MetricsSnapshot) { s.Pops++ })
+}
+
+func (m *InMemoryMetrics) Update() {
+	m.update(func(s *MetricsSnapshot) { s.Updates++ })
+}
+
+func (m *InMemoryMetrics) Delete() {
+	m.update(func(s *MetricsSnapshot) { s.Deletes++ })
+}
+
+func (m *InMemoryMetrics) Latency(latency time.Duration) {
+	m.update(func(s *MetricsSnapshot) {
+		s.LatencyCount++
+		s.LatencySum += latency
+		if latency > s.LatencyMax {
+			s.LatencyMax = latency
+		}
+	})
+}
+
+func (m *InMemoryMetrics) Waiting(size int) {
+	m.update(func(s *MetricsSnapshot) { s.Waiting = size })
+}
+
+func (m *InMemoryMetrics) DelayedAdd() {
+	m.update(func(s *MetricsSnapshot) { s.DelayedAdds++ })
+}
+
+func (m *InMemoryMetrics) Retry() {
+	m.update(func(s *MetricsSnapshot) { s.Retries++ })
+}
+
+func (m *InMemoryMetrics) Expire() {
+	m.update(func(s *MetricsSnapshot) { s.Expired++ })
+}
+
+func (m *InMemoryMetrics) Oldest(at time.Time) {
+	m.lock.Lock()
+	m.oldest = at
+	m.lock.Unlock()
+}
+
+// InMemoryMetricsProvider creates InMemoryMetrics, typically for tests.
+type InMemoryMetricsProvider struct {
+	lock    sync.Mutex
+	metrics map[string]*InMemoryMetrics
+}
+
+func NewInMemoryMetricsProvider() *InMemoryMetricsProvider {
+	return &InMemoryMetricsProvider{metrics: make(map[string]*InMemoryMetrics)}
+}
+
+func (p *InMemoryMetricsProvider) NewQueueMetrics(name string) QueueMetrics {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	m, ok := p.metrics[name]
+	if !ok {
+		m = &InMemoryMetrics{}
+		p.metrics[name] = m
+	}
+	return m
+}
+
+// Get returns the metrics of the named queue.
+func (p *InMemoryMetricsProvider) Get(name string) (*InMemoryMetrics, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	m, ok := p.metrics[name]
+	return m, ok
+}
@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBlockQueue_Metrics(t *testing.T) {
+	provider := NewInMemoryMetricsProvider()
+	queue := newBlockQueue[*testItem](&testConstraint{}, WithMetrics("block", provider))
+	metrics, ok := provider.Get("block")
+
+	convey.Convey("test block queue metrics", t, func() {
+		convey.So(ok, convey.ShouldBeTrue)
+
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		queue.Add(&testItem{key: "Item_1", value: 1})
+		queue.Add(&testItem{key: "Item_1", value: 2})
+		convey.So(queue.Update(&testItem{key: "Item_0", value: 3}), convey.ShouldBeNil)
+		time.Sleep(10 * time.Millisecond)
+
+		snapshot := metrics.Snapshot()
+		convey.So(snapshot.Adds, convey.ShouldEqual, 2)
+		convey.So(snapshot.Updates, convey.ShouldEqual, 2)
+		convey.So(snapshot.Depth, convey.ShouldEqual, 2)
+		// The age keeps growing while the queue does not change.
+		convey.So(snapshot.OldestAge, convey.ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+
+		_, err := queue.Pop()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(queue.Delete(&testItem{key: "Item_0"}), convey.ShouldBeNil)
+
+		snapshot = metrics.Snapshot()
+		convey.So(snapshot.Pops, convey.ShouldEqual, 1)
+		convey.So(snapshot.Deletes, convey.ShouldEqual, 1)
+		convey.So(snapshot.Depth, convey.ShouldEqual, 0)
+		convey.So(snapshot.LatencyCount, convey.ShouldEqual, 1)
+		convey.So(snapshot.LatencyMax, convey.ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+		convey.So(snapshot.OldestAge, convey.ShouldEqual, 0)
+	})
+}
+
+func TestRateLimitingQueue_Metrics(t *testing.T) {
+	provider := NewInMemoryMetricsProvider()
+	queue := newRateLimitingQueue[*testItem](&testConstraint{},
+		NewItemExponentialFailureRateLimiter(100*time.Millisecond, time.Second), WithMetrics("retry", provider))
+	defer queue.Shutdown()
+	metrics, _ := provider.Get("retry")
+
+	convey.Convey("test delayed adds and retries", t, func() {
+		queue.AddAfter(&testItem{key: "Item_0", value: 0}, 100*time.Millisecond)
+		queue.AddRateLimited(&testItem{key: "Item_1", value: 1})
+		eventually(func() bool { return metrics.Snapshot().Waiting == 2 })
+
+		snapshot := metrics.Snapshot()
+		convey.So(snapshot.DelayedAdds, convey.ShouldEqual, 2)
+		convey.So(snapshot.Retries, convey.ShouldEqual, 1)
+		convey.So(snapshot.Waiting, convey.ShouldEqual, 2)
+
+		_, err := queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		_, err = queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+
+		snapshot = metrics.Snapshot()
+		convey.So(snapshot.Waiting, convey.ShouldEqual, 0)
+		convey.So(snapshot.Adds, convey.ShouldEqual, 2)
+		convey.So(snapshot.Pops, convey.ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,44 @@
+package queue
+
+import "sync"
+
+// notifier is a condition variable giving each waiter its own wakeup, so that
+// a waiter can give up, when its context is done, without waking the others
+// up. Broadcast wakes every waiter up, like sync.Cond.
+type notifier struct {
+	L sync.Locker
+
+	lock    sync.Mutex
+	waiters map[chan struct{}]struct{}
+}
+
+func newNotifier(l sync.Locker) *notifier {
+	return &notifier{L: l, waiters: make(map[chan struct{}]struct{})}
+}
+
+// wait registers a waiter and returns the channel closed by the next
+// Broadcast. It must be called with n.L held, before n.L is released to wait.
+func (n *notifier) wait() chan struct{} {
+	wake := make(chan struct{})
+	n.lock.Lock()
+	n.waiters[wake] = struct{}{}
+	n.lock.Unlock()
+	return wake
+}
+
+// leave unregisters a waiter which did not wait for its wakeup.
+func (n *notifier) leave(wake chan struct{}) {
+	n.lock.Lock()
+	delete(n.waiters, wake)
+	n.lock.Unlock()
+}
+
+// Broadcast wakes all the waiters up.
+func (n *notifier) Broadcast() {
+	n.lock.Lock()
+	for wake := range n.waiters {
+		close(wake)
+		delete(n.waiters, wake)
+	}
+	n.lock.Unlock()
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// OpenMetricsContentType is the content type of WriteOpenMetrics.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+type openMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(s *MetricsSnapshot) string
+}
+
+func gaugeMetric(name, help string, value func(s *MetricsSnapshot) string) openMetric {
+	return openMetric{name: name, kind: "gauge", help: help, value: value}
+}
+
+func counterMetric(name, help string, value func(s *MetricsSnapshot) uint64) openMetric {
+	return openMetric{name: name, kind: "counter", help: help, value: func(s *MetricsSnapshot) string {
+		return fmt.Sprint(value(s))
+	}}
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprint(d.Seconds())
+}
+
+var openMetrics = []openMetric{
+	gaugeMetric("queue_depth", "Number of items ready to be popped.", func(s *MetricsSnapshot) string {
+		return fmt.Sprint(s.Depth)
+	}),
+	gaugeMetric("queue_waiting", "Number of delayed items not ready yet.", func(s *MetricsSnapshot) string {
+		return fmt.Sprint(s.Waiting)
+	}),
+	gaugeMetric("queue_oldest_age_seconds", "Age of the oldest ready item.", func(s *MetricsSnapshot) string {
+		return formatSeconds(s.OldestAge)
+	}),
+	counterMetric("queue_adds", "Items added.", func(s *MetricsSnapshot) uint64 { return s.Adds }),
+	counterMetric("queue_pops", "Items popped.", func(s *MetricsSnapshot) uint64 { return s.Pops }),
+	counterMetric("queue_updates", "Items updated.", func(s *MetricsSnapshot) uint64 { return s.Updates }),
+	counterMetric("queue_deletes", "Items deleted.", func(s *MetricsSnapshot) uint64 { return s.Deletes }),
+	counterMetric("queue_delayed_adds", "Items added with a delay.", func(s *MetricsSnapshot) uint64 { return s.DelayedAdds }),
+	counterMetric("queue_retries", "Items requeued through the rate limiter.", func(s *MetricsSnapshot) uint64 { return s.Retries }),
+	counterMetric("queue_expired", "Items dropped once their TTL elapsed.", func(s *MetricsSnapshot) uint64 { return s.Expired }),
+}
+
+// WriteOpenMetrics writes the stats of the registered queues in the
+// OpenMetrics text format. Queues without stats are skipped.
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	var stats []*MetricsSnapshot
+	var names []string
+	for _, info := range r.Inspect(0) {
+		if info.Stats != nil {
+			names = append(names, escapeLabel(info.Name))
+			stats = append(stats, info.Stats)
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	for _, metric := range openMetrics {
+		fmt.Fprintf(b, "# TYPE %s %s\n# HELP %s %s\n", metric.name, metric.kind, metric.name, metric.help)
+		sample := metric.name
+		if metric.kind == "counter" {
+			sample += "_total"
+		}
+		for i, s := range stats {
+			fmt.Fprintf(b, "%s{queue=\"%s\"} %s\n", sample, names[i], metric.value(s))
+		}
+	}
+
+	fmt.Fprint(b, "# TYPE queue_latency_seconds summary\n# HELP queue_latency_seconds Time from add to pop.\n")
+	for i, s := range stats {
+		fmt.Fprintf(b, "queue_latency_seconds_count{queue=\"%s\"} %d\n", names[i], s.LatencyCount)
+		fmt.Fprintf(b, "queue_latency_seconds_sum{queue=\"%s\"} %s\n", names[i], formatSeconds(s.LatencySum))
+	}
+	fmt.Fprint(b, "# EOF\n")
+	return b.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
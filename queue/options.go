@@ -0,0 +1,69 @@
+package queue
+
+import "time"
+
+// OverflowPolicy decides what happens when an item is added to a full queue.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the producer wait for room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject rejects the new item with ErrFull.
+	OverflowReject
+	// OverflowEvict drops the lowest priority item, which may be the new
+	// one, to make room.
+	OverflowEvict
+)
+
+type options struct {
+	capacity int
+	overflow OverflowPolicy
+
+	highWatermark int
+	lowWatermark  int
+	onHigh        func(length int)
+	onLow         func(length int)
+
+	metrics QueueMetrics
+	aging   *AgingPolicy
+
+	ttl      time.Duration
+	onExpire func(value any)
+
+	debounce *debounceOptions
+
+	watchBuffer int
+	watchPolicy SlowSubscriberPolicy
+}
+
+// Option configures a queue.
+type Option func(*options)
+
+func newOptions(opts []Option) options {
+	cfg := options{metrics: noopMetrics{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithCapacity bounds the number of items of the queue. Updating an item
+// already in the queue never counts against the capacity.
+func WithCapacity(capacity int, policy OverflowPolicy) Option {
+	return func(cfg *options) {
+		cfg.capacity = capacity
+		cfg.overflow = policy
+	}
+}
+
+// WithWatermarks calls onHigh when the length of the queue reaches high, and
+// onLow when it falls back to low afterwards, so that producers can throttle.
+// The callbacks are called without holding the queue lock; either may be nil.
+func WithWatermarks(high, low int, onHigh, onLow func(length int)) Option {
+	return func(cfg *options) {
+		cfg.highWatermark = high
+		cfg.lowWatermark = low
+		cfg.onHigh = onHigh
+		cfg.onLow = onLow
+	}
+}
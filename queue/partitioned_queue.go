@@ -0,0 +1,263 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+// NewPartitionedQueue returns a WorkQueue processing the items of a partition,
+// as returned by partition for an item, one at a time: once an item is
+// popped, the other items of its partition are held back until Done is
+// called for it. Items of a partition pop in priority order, and the
+// partitions with no item in flight compete by the priority of their head.
+func NewPartitionedQueue[V any](constraint HeapConstraint[V], partition func(V) string, opts ...Option) WorkQueue[V] {
+	return newPartitionedQueue[V](constraint, partition, opts...)
+}
+
+func newPartitionedQueue[V any](constraint HeapConstraint[V], partition func(V) string, opts ...Option) *blockQueue[V] {
+	cfg := newOptions(opts)
+	partitions := newPartitionHeap[V](constraint, partition, cfg)
+	que := newBlockQueueWith[V](constraint, partitions, cfg)
+	que.processing = newProcessing[V]()
+	que.partitions = partitions
+	return que
+}
+
+type partition[V any] struct {
+	name  string
+	items heap.Heap[V]
+	// busy is set while an item of the partition is in flight.
+	busy bool
+}
+
+type partitionOrder[V any] struct {
+	constraint HeapConstraint[V]
+}
+
+func (order *partitionOrder[V]) FormStoreKey(p *partition[V]) string {
+	return p.name
+}
+
+func (order *partitionOrder[V]) Less(left, right *partition[V]) bool {
+	headLeft, errLeft := left.items.Peek()
+	headRight, errRight := right.items.Peek()
+	if errLeft != nil || errRight != nil {
+		return errRight != nil && errLeft == nil
+	}
+	return order.constraint.Less(headLeft, headRight)
+}
+
+// partitionHeap is a heap.Heap popping at most one item per partition until
+// the partition is released.
+type partitionHeap[V any] struct {
+	lock        sync.Mutex
+	constraint  HeapConstraint[V]
+	partitionOf func(V) string
+	newItems    func() heap.Heap[V]
+
+	// eligible holds the partitions with items and none in flight, by the
+	// priority of their head.
+	eligible   heap.Heap[*partition[V]]
+	partitions map[string]*partition[V]
+	// keys maps the keys of the items to their partition.
+	keys   map[string]*partition[V]
+	length int
+}
+
+func newPartitionHeap[V any](constraint HeapConstraint[V], partitionOf func(V) string, cfg options) *partitionHeap[V] {
+	return &partitionHeap[V]{
+		constraint:  constraint,
+		partitionOf: partitionOf,
+		newItems: func() heap.Heap[V] {
+			return newItemHeap[V](constraint, cfg)
+		},
+		eligible:   heap.New[string, *partition[V]](&partitionOrder[V]{constraint: constraint}),
+		partitions: make(map[string]*partition[V]),
+		keys:       make(map[string]*partition[V]),
+	}
+}
+
+func (h *partitionHeap[V]) Add(value V) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := h.constraint.FormStoreKey(value)
+	name := h.partitionOf(value)
+	if p, ok := h.keys[key]; ok {
+		if p.name == name {
+			p.items.Add(value)
+			h.fixLocked(p)
+			return
+		}
+		// The item moved to another partition.
+		_ = h.deleteLocked(p, value)
+	}
+
+	p, ok := h.partitions[name]
+	if !ok {
+		p = &partition[V]{name: name, items: h.newItems()}
+		h.partitions[name] = p
+	}
+	p.items.Add(value)
+	h.keys[key] = p
+	h.length++
+	h.fixLocked(p)
+}
+
+func (h *partitionHeap[V]) Delete(value V) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	p, ok := h.keys[h.constraint.FormStoreKey(value)]
+	if !ok {
+		return fmt.Errorf("can not find item: %v in partition heap", value)
+	}
+	return h.deleteLocked(p, value)
+}
+
+func (h *partitionHeap[V]) deleteLocked(p *partition[V], value V) error {
+	if err := p.items.Delete(value); err != nil {
+		return err
+	}
+	delete(h.keys, h.constraint.FormStoreKey(value))
+	h.length--
+	h.fixLocked(p)
+	return nil
+}
+
+// fixLocked updates the position of p among the eligible partitions after
+// its items changed, and forgets it once it is idle and empty.
+func (h *partitionHeap[V]) fixLocked(p *partition[V]) {
+	if p.busy {
+		return
+	}
+	if p.items.Len() == 0 {
+		_ = h.eligible.Delete(p)
+		delete(h.partitions, p.name)
+		return
+	}
+	h.eligible.Add(p)
+}
+
+func (h *partitionHeap[V]) Peek() (V, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	p, err := h.eligible.Peek()
+	if err != nil {
+		return *new(V), err
+	}
+	return p.items.Peek()
+}
+
+// PeekN returns the heads of the first n eligible partitions, the items PopN
+// would return.
+func (h *partitionHeap[V]) PeekN(n int) []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	heads := h.eligible.PeekN(n)
+	values := make([]V, 0, len(heads))
+	for _, p := range heads {
+		if value, err := p.items.Peek(); err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Pop pops the head of the first eligible partition, which stays busy until
+// it is released.
+func (h *partitionHeap[V]) Pop() (V, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.popLocked()
+}
+
+func (h *partitionHeap[V]) popLocked() (V, error) {
+	p, err := h.eligible.Pop()
+	if err != nil {
+		return *new(V), err
+	}
+	value, err := p.items.Pop()
+	if err != nil {
+		return value, err
+	}
+	delete(h.keys, h.constraint.FormStoreKey(value))
+	h.length--
+	p.busy = true
+	return value, nil
+}
+
+func (h *partitionHeap[V]) PopN(n int) []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if n <= 0 {
+		return []V{}
+	}
+
+	size := h.eligible.Len()
+	if n < size {
+		size = n
+	}
+	values := make([]V, 0, size)
+	for len(values) < n {
+		value, err := h.popLocked()
+		if err != nil {
+			break
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func (h *partitionHeap[V]) Get(value V) (V, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	p, ok := h.keys[h.constraint.FormStoreKey(value)]
+	if !ok {
+		return *new(V), false
+	}
+	return p.items.Get(value)
+}
+
+func (h *partitionHeap[V]) List() []V {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	list := make([]V, 0, h.length)
+	for _, p := range h.partitions {
+		list = append(list, p.items.List()...)
+	}
+	return list
+}
+
+// Len counts the items of every partition, including the ones held back.
+func (h *partitionHeap[V]) Len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.length
+}
+
+// ready reports whether an item can be popped.
+func (h *partitionHeap[V]) ready() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.eligible.Len() > 0
+}
+
+// release makes the partition of value eligible again.
+func (h *partitionHeap[V]) release(value V) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	p, ok := h.partitions[h.partitionOf(value)]
+	if !ok || !p.busy {
+		return
+	}
+	p.busy = false
+	h.fixLocked(p)
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestPartitionedQueue(t *testing.T) {
+	convey.Convey("test partitioned queue", t, func() {
+		queue := newPartitionedQueue[*testItem](&testConstraint{}, testTenant)
+		for i := 0; i < 3; i++ {
+			queue.Add(&testItem{key: fmt.Sprintf("a_%d", i), value: i})
+			queue.Add(&testItem{key: fmt.Sprintf("b_%d", i), value: 10 + i})
+		}
+		queue.Add(&testItem{key: "c_0", value: 5})
+
+		convey.Convey("test one item per partition is in flight", func() {
+			convey.So(len(queue.PeekN(10)), convey.ShouldEqual, 3)
+			items, err := queue.PopN(10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(items), convey.ShouldEqual, 3)
+			convey.So(items[0].key, convey.ShouldEqual, "a_0")
+			convey.So(items[1].key, convey.ShouldEqual, "c_0")
+			convey.So(items[2].key, convey.ShouldEqual, "b_0")
+			convey.So(queue.Len(), convey.ShouldEqual, 4)
+
+			_, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err = queue.PopContext(ctx)
+			convey.So(err == context.DeadlineExceeded, convey.ShouldBeTrue)
+
+			convey.Convey("test done releases the partition in order", func() {
+				popped := make(chan *testItem)
+				go func() {
+					item, _ := queue.Pop()
+					popped <- item
+				}()
+				queue.Done(items[2])
+				item := <-popped
+				convey.So(item.key, convey.ShouldEqual, "b_1")
+
+				queue.Done(items[0])
+				item, ok := queue.TryPop()
+				convey.So(ok, convey.ShouldBeTrue)
+				convey.So(item.key, convey.ShouldEqual, "a_1")
+
+				// Done for an idle partition keeps its order.
+				queue.Done(items[1])
+				_, ok = queue.TryPop()
+				convey.So(ok, convey.ShouldBeFalse)
+			})
+
+			convey.Convey("test only the item in flight releases the partition", func() {
+				queue.Done(&testItem{key: "a_9", value: 9})
+				_, ok := queue.TryPop()
+				convey.So(ok, convey.ShouldBeFalse)
+
+				queue.Done(items[0])
+				item, ok := queue.TryPop()
+				convey.So(ok, convey.ShouldBeTrue)
+				convey.So(item.key, convey.ShouldEqual, "a_1")
+
+				queue.Done(items[0])
+				_, ok = queue.TryPop()
+				convey.So(ok, convey.ShouldBeFalse)
+			})
+
+			convey.Convey("test items held back are discarded", func() {
+				discarded := queue.ShutdownWithDiscard()
+				convey.So(len(discarded), convey.ShouldEqual, 4)
+				convey.So(discarded[0].key, convey.ShouldEqual, "a_1")
+				convey.So(queue.Len(), convey.ShouldEqual, 0)
+			})
+		})
+
+		convey.Convey("test taking no items", func() {
+			convey.So(queue.partitions.PeekN(-1), convey.ShouldBeEmpty)
+			convey.So(queue.partitions.PopN(-1), convey.ShouldBeEmpty)
+			convey.So(queue.partitions.PopN(0), convey.ShouldBeEmpty)
+			convey.So(queue.Len(), convey.ShouldEqual, 7)
+		})
+
+		convey.Convey("test updating and deleting held back items", func() {
+			item, err := queue.Pop()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.key, convey.ShouldEqual, "a_0")
+
+			convey.So(queue.Update(&testItem{key: "a_2", value: -1}), convey.ShouldBeNil)
+			convey.So(queue.Delete(&testItem{key: "a_1"}), convey.ShouldBeNil)
+			queue.Done(item)
+
+			item, err = queue.Pop()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(item.key, convey.ShouldEqual, "a_2")
+			convey.So(queue.Len(), convey.ShouldEqual, 4)
+		})
+	})
+}
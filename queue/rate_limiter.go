@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter decides how long an item has to wait before it is retried.
+// Items are identified by their store key.
+type RateLimiter interface {
+	// When records a retry of key and returns how long to wait for it.
+	When(key string) time.Duration
+	// Forget clears the retry history of key, typically once it succeeded.
+	Forget(key string)
+	// NumRequeues returns how many times key has been retried.
+	NumRequeues(key string) int
+}
+
+// DefaultRateLimiter combines a per-item exponential backoff with an overall
+// token bucket of 10 retries per second and a burst of 100.
+func DefaultRateLimiter() RateLimiter {
+	return NewMaxOfRateLimiter(
+		NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
+		NewBucketRateLimiter(10, 100),
+	)
+}
+
+type itemExponentialFailureRateLimiter struct {
+	lock     sync.Mutex
+	failures map[string]int
+
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// NewItemExponentialFailureRateLimiter waits baseDelay*2^n before the n-th
+// retry of an item, up to maxDelay.
+func NewItemExponentialFailureRateLimiter(baseDelay, maxDelay time.Duration) RateLimiter {
+	return &itemExponentialFailureRateLimiter{
+		failures:  make(map[string]int),
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+	}
+}
+
+func (r *itemExponentialFailureRateLimiter) When(key string) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	exp := r.failures[key]
+	r.failures[key] = exp + 1
+
+	backoff := float64(r.baseDelay.Nanoseconds()) * math.Pow(2, float64(exp))
+	if backoff > float64(r.maxDelay.Nanoseconds()) {
+		return r.maxDelay
+	}
+	return time.Duration(backoff)
+}
+
+func (r *itemExponentialFailureRateLimiter) Forget(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.failures, key)
+}
+
+func (r *itemExponentialFailureRateLimiter) NumRequeues(key string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.failures[key]
+}
+
+type bucketRateLimiter struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewBucketRateLimiter is a token bucket shared by every item: it allows rate
+// retries per second with bursts of up to burst retries.
+func NewBucketRateLimiter(rate float64, burst int) RateLimiter {
+	return &bucketRateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// When reserves a token and returns how long to wait until it is available.
+func (r *bucketRateLimiter) When(string) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+	if !r.last.IsZero() {
+		r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	}
+	r.last = now
+
+	r.tokens--
+	if r.tokens >= 0 || r.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.rate * float64(time.Second))
+}
+
+func (r *bucketRateLimiter) Forget(string) {}
+
+func (r *bucketRateLimiter) NumRequeues(string) int {
+	return 0
+}
+
+type maxOfRateLimiter struct {
+	limiters []RateLimiter
+}
+
+// NewMaxOfRateLimiter waits for the longest delay of the given limiters.
+func NewMaxOfRateLimiter(limiters ...RateLimiter) RateLimiter {
+	return &maxOfRateLimiter{limiters: limiters}
+}
+
+func (r *maxOfRateLimiter) When(key string) time.Duration {
+	var delay time.Duration
+	for _, limiter := range r.limiters {
+		if d := limiter.When(key); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+func (r *maxOfRateLimiter) Forget(key string) {
+	for _, limiter := range r.limiters {
+		limiter.Forget(key)
+	}
+}
+
+func (r *maxOfRateLimiter) NumRequeues(key string) int {
+	requeues := 0
+	for _, limiter := range r.limiters {
+		if n := limiter.NumRequeues(key); n > requeues {
+			requeues = n
+		}
+	}
+	return requeues
+}
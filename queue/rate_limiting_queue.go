@@ -0,0 +1,41 @@
+package queue
+
+type rateLimitingQueue[V any] struct {
+	*delayingQueue[V]
+	constraint HeapConstraint[V]
+	limiter    RateLimiter
+}
+
+// NewRateLimitingQueue returns a DelayingQueue which requeues failed items
+// after the delay decided by limiter. A nil limiter uses DefaultRateLimiter.
+func NewRateLimitingQueue[V any](constraint HeapConstraint[V], limiter RateLimiter, opts ...Option) RateLimitingQueue[V] {
+	return newRateLimitingQueue[V](constraint, limiter, opts...)
+}
+
+func newRateLimitingQueue[V any](constraint HeapConstraint[V], limiter RateLimiter, opts ...Option) *rateLimitingQueue[V] {
+	if limiter == nil {
+		limiter = DefaultRateLimiter()
+	}
+	return &rateLimitingQueue[V]{
+		delayingQueue: newDelayingQueue[V](constraint, opts...),
+		constraint:    constraint,
+		limiter:       limiter,
+	}
+}
+
+// AddRateLimited adds the item back once the rate limiter allows it.
+func (q *rateLimitingQueue[V]) AddRateLimited(value V) {
+	q.mainQueue.opts.metrics.Retry()
+	q.AddAfter(value, q.limiter.When(q.constraint.FormStoreKey(value)))
+}
+
+// Forget clears the retry history of the item. It does not remove the item
+// from the queue.
+func (q *rateLimitingQueue[V]) Forget(value V) {
+	q.limiter.Forget(q.constraint.FormStoreKey(value))
+}
+
+// NumRequeues returns how many times the item has been requeued.
+func (q *rateLimitingQueue[V]) NumRequeues(value V) int {
+	return q.limiter.NumRequeues(q.constraint.FormStoreKey(value))
+}
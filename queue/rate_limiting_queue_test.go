@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimiters(t *testing.T) {
+	convey.Convey("test rate limiters", t, func() {
+		convey.Convey("test item exponential failure", func() {
+			limiter := NewItemExponentialFailureRateLimiter(time.Millisecond, 5*time.Millisecond)
+			for _, expected := range []time.Duration{1, 2, 4, 5, 5} {
+				convey.So(limiter.When("one"), convey.ShouldEqual, expected*time.Millisecond)
+			}
+			convey.So(limiter.NumRequeues("one"), convey.ShouldEqual, 5)
+			convey.So(limiter.When("two"), convey.ShouldEqual, time.Millisecond)
+
+			limiter.Forget("one")
+			convey.So(limiter.NumRequeues("one"), convey.ShouldEqual, 0)
+			convey.So(limiter.When("one"), convey.ShouldEqual, time.Millisecond)
+		})
+
+		convey.Convey("test token bucket", func() {
+			limiter := NewBucketRateLimiter(1, 2).(*bucketRateLimiter)
+			now := time.Now()
+			limiter.now = func() time.Time { return now }
+			convey.So(limiter.When("one"), convey.ShouldEqual, 0)
+			convey.So(limiter.When("two"), convey.ShouldEqual, 0)
+			convey.So(limiter.When("three"), convey.ShouldEqual, time.Second)
+			convey.So(limiter.When("four"), convey.ShouldEqual, 2*time.Second)
+
+			now = now.Add(3 * time.Second)
+			convey.So(limiter.When("five"), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test max of", func() {
+			limiter := NewMaxOfRateLimiter(
+				NewItemExponentialFailureRateLimiter(time.Millisecond, time.Second),
+				NewItemExponentialFailureRateLimiter(3*time.Millisecond, 4*time.Millisecond),
+			)
+			convey.So(limiter.When("one"), convey.ShouldEqual, 3*time.Millisecond)
+			convey.So(limiter.When("one"), convey.ShouldEqual, 4*time.Millisecond)
+			convey.So(limiter.When("one"), convey.ShouldEqual, 4*time.Millisecond)
+			convey.So(limiter.When("one"), convey.ShouldEqual, 8*time.Millisecond)
+			convey.So(limiter.NumRequeues("one"), convey.ShouldEqual, 4)
+			limiter.Forget("one")
+			convey.So(limiter.NumRequeues("one"), convey.ShouldEqual, 0)
+		})
+	})
+}
+
+func TestRateLimitingQueue(t *testing.T) {
+	queue := newRateLimitingQueue[*testItem](&testConstraint{},
+		NewItemExponentialFailureRateLimiter(50*time.Millisecond, time.Second))
+	defer queue.Shutdown()
+
+	convey.Convey("test rate limited requeue", t, func() {
+		item := &testItem{key: "Item_0"}
+		queue.AddRateLimited(item)
+		convey.So(queue.NumRequeues(item), convey.ShouldEqual, 1)
+
+		_, ok := queue.TryPop()
+		convey.So(ok, convey.ShouldBeFalse)
+		popped, err := queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(popped.key, convey.ShouldEqual, item.key)
+
+		queue.AddRateLimited(item)
+		convey.So(queue.NumRequeues(item), convey.ShouldEqual, 2)
+		_, err = queue.PopTimeout(60 * time.Millisecond)
+		convey.So(err, convey.ShouldEqual, ErrTimeout)
+		_, err = queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+
+		queue.Forget(item)
+		convey.So(queue.NumRequeues(item), convey.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueueInfo describes a registered queue.
+type QueueInfo struct {
+	Name     string `json:"name"`
+	Len      int    `json:"len"`
+	Shutdown bool   `json:"shutdown"`
+	// Stats is nil unless the queue reports its metrics to the registry.
+	Stats *MetricsSnapshot `json:"stats,omitempty"`
+	// Top lists the first items in priority order.
+	Top []string `json:"top"`
+	// Upcoming lists the first delayed items by readyAt, for delaying
+	// queues.
+	Upcoming []UpcomingItem `json:"upcoming,omitempty"`
+}
+
+// UpcomingItem is a delayed item with the time it becomes ready.
+type UpcomingItem struct {
+	Item    string    `json:"item"`
+	ReadyAt time.Time `json:"readyAt"`
+}
+
+// Registry collects queues for inspection. It is a MetricsProvider as well:
+// queues built WithMetrics(name, registry) get their stats reported under the
+// same name they are registered with.
+type Registry struct {
+	*InMemoryMetricsProvider
+
+	lock   sync.RWMutex
+	queues map[string]func(n int) QueueInfo
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		InMemoryMetricsProvider: NewInMemoryMetricsProvider(),
+		queues:                  make(map[string]func(n int) QueueInfo),
+	}
+}
+
+// Register adds the queue to the registry under name, replacing any queue
+// registered under the same name. Items are rendered with format; a nil
+// format falls back to fmt.Sprint.
+func Register[V any](r *Registry, name string, q Queue[V], format func(V) string) {
+	if format == nil {
+		format = func(value V) string {
+			return fmt.Sprint(value)
+		}
+	}
+
+	inspect := func(n int) QueueInfo {
+		info := QueueInfo{Name: name, Len: q.Len(), Top: make([]string, 0, n)}
+		if stopper, ok := q.(interface{ IsShutdown() bool }); ok {
+			info.Shutdown = stopper.IsShutdown()
+		}
+		if metrics, ok := r.Get(name); ok {
+			stats := metrics.Snapshot()
+			info.Stats = &stats
+		}
+		for _, item := range q.PeekN(n) {
+			info.Top = append(info.Top, format(item))
+		}
+		if delaying, ok := q.(interface{ upcoming(n int) []*waitFor[V] }); ok {
+			for _, item := range delaying.upcoming(n) {
+				info.Upcoming = append(info.Upcoming, UpcomingItem{Item: format(item.value), ReadyAt: item.readyAt})
+			}
+		}
+		return info
+	}
+
+	r.lock.Lock()
+	r.queues[name] = inspect
+	r.lock.Unlock()
+}
+
+// Unregister removes the queue registered under name.
+func (r *Registry) Unregister(name string) {
+	r.lock.Lock()
+	delete(r.queues, name)
+	r.lock.Unlock()
+}
+
+// Inspect describes the registered queues sorted by name, with up to n items
+// in Top and Upcoming.
+func (r *Registry) Inspect(n int) []QueueInfo {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.queues))
+	for name := range r.queues {
+		names = append(names, name)
+	}
+	inspects := make([]func(n int) QueueInfo, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		inspects = append(inspects, r.queues[name])
+	}
+	r.lock.RUnlock()
+
+	infos := make([]QueueInfo, 0, len(inspects))
+	for _, inspect := range inspects {
+		infos = append(infos, inspect(n))
+	}
+	return infos
+}
+
+// PublishExpvar publishes the registered queues as the expvar variable name,
+// with up to top items per queue. Like expvar.Publish, it panics if name is
+// already in use.
+func (r *Registry) PublishExpvar(name string, top int) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return r.Inspect(top)
+	}))
+}
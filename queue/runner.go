@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Handler processes an item popped by Run. A non-nil error retries the item.
+type Handler[V any] func(ctx context.Context, value V) error
+
+// PanicError is the error reported when a handler panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+type runOptions[V any] struct {
+	limiter    RateLimiter
+	maxRetries int
+	timeout    time.Duration
+	onError    func(value V, err error)
+}
+
+// RunOption configures Run.
+type RunOption[V any] func(*runOptions[V])
+
+// WithRetry retries failed items after the delay decided by limiter, at most
+// maxRetries times; maxRetries <= 0 retries forever. It defaults to
+// DefaultRateLimiter without a bound. Dead-letter queues are retried through
+// their own Retry instead.
+func WithRetry[V any](limiter RateLimiter, maxRetries int) RunOption[V] {
+	return func(cfg *runOptions[V]) {
+		cfg.limiter = limiter
+		cfg.maxRetries = maxRetries
+	}
+}
+
+// WithItemTimeout cancels the context of a handler once timeout elapsed.
+func WithItemTimeout[V any](timeout time.Duration) RunOption[V] {
+	return func(cfg *runOptions[V]) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithErrorHandler calls onError for every failure of a handler, panics
+// included as a *PanicError.
+func WithErrorHandler[V any](onError func(value V, err error)) RunOption[V] {
+	return func(cfg *runOptions[V]) {
+		cfg.onError = onError
+	}
+}
+
+// Runner is a pool of workers popping items from a queue.
+type Runner[V any] struct {
+	queue   DelayingQueue[V]
+	handler Handler[V]
+	opts    runOptions[V]
+	key     func(V) string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	lock    sync.Mutex
+	workers []context.CancelFunc
+}
+
+// Run starts workers goroutines handling the items of q until ctx is done,
+// Stop is called or q is shut down. A failed item is marked Done, for work
+// queues, and added back with AddAfter once the backoff elapsed; a succeeded
+// item is forgotten by the limiter. Stopping lets the handlers in flight
+// finish, their context is only canceled by the item timeout.
+func Run[V any](ctx context.Context, q DelayingQueue[V], workers int, handler Handler[V], opts ...RunOption[V]) *Runner[V] {
+	cfg := runOptions[V]{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.limiter == nil {
+		cfg.limiter = DefaultRateLimiter()
+	}
+
+	r := &Runner[V]{
+		queue:   q,
+		handler: handler,
+		opts:    cfg,
+		key: func(value V) string {
+			return fmt.Sprint(value)
+		},
+	}
+	if keyed, ok := q.(interface{ storeKey(V) string }); ok {
+		r.key = keyed.storeKey
+	}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	r.Resize(workers)
+	return r
+}
+
+// Resize changes the number of workers. Removed workers exit once their
+// current item is handled. It does nothing once the runner stopped.
+func (r *Runner[V]) Resize(workers int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.ctx.Err() != nil {
+		return
+	}
+
+	for len(r.workers) < workers {
+		ctx, cancel := context.WithCancel(r.ctx)
+		r.workers = append(r.workers, cancel)
+		r.wg.Add(1)
+		go r.work(ctx)
+	}
+	for len(r.workers) > workers && len(r.workers) > 0 {
+		last := len(r.workers) - 1
+		r.workers[last]()
+		r.workers = r.workers[:last]
+	}
+}
+
+// Workers returns the number of workers.
+func (r *Runner[V]) Workers() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.workers)
+}
+
+// Stop stops the workers. Use Wait to wait for the handlers in flight.
+func (r *Runner[V]) Stop() {
+	r.cancel()
+}
+
+// Wait blocks until the runner stopped and every handler returned.
+func (r *Runner[V]) Wait() {
+	<-r.ctx.Done()
+	// Resize adds workers under the lock, none can be added past this point.
+	r.lock.Lock()
+	r.workers = nil
+	r.lock.Unlock()
+	r.wg.Wait()
+}
+
+func (r *Runner[V]) work(ctx context.Context) {
+	defer r.wg.Done()
+	for {
+		value, err := r.queue.PopContext(ctx)
+		if err == ErrShutdown {
+			r.cancel()
+			return
+		}
+		if err != nil {
+			return
+		}
+		r.process(value)
+	}
+}
+
+func (r *Runner[V]) process(value V) {
+	err := r.handle(value)
+	// requeued is set when the item was added again while it was handled
+	// and Done put the newer value back in the queue.
+	requeued := false
+	if done, ok := r.queue.(interface{ done(V) bool }); ok {
+		requeued = done.done(value)
+	}
+
+	if dead, ok := r.queue.(DeadLetterQueue[V]); ok {
+		if err == nil {
+			dead.Forget(value)
+		} else {
+			r.failed(value, err)
+			dead.Retry(value, err)
+		}
+		return
+	}
+
+	key := r.key(value)
+	if err == nil {
+		r.opts.limiter.Forget(key)
+		return
+	}
+	r.failed(value, err)
+	if requeued {
+		// Retrying would handle the item twice.
+		return
+	}
+	if r.opts.maxRetries > 0 && r.opts.limiter.NumRequeues(key) >= r.opts.maxRetries {
+		r.opts.limiter.Forget(key)
+		return
+	}
+	r.queue.AddAfter(value, r.opts.limiter.When(key))
+}
+
+func (r *Runner[V]) handle(value V) (err error) {
+	ctx := context.Background()
+	if r.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.opts.timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = &PanicError{Value: recovered, Stack: debug.Stack()}
+		}
+	}()
+	return r.handler(ctx, value)
+}
+
+func (r *Runner[V]) failed(value V, err error) {
+	if r.opts.onError != nil {
+		r.opts.onError(value, err)
+	}
+}
@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRun(t *testing.T) {
+	convey.Convey("test running workers over a queue", t, func() {
+		queue := newDelayingQueue[*testItem](&testConstraint{})
+		defer queue.Shutdown()
+		limiter := NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)
+
+		convey.Convey("test items are retried until they succeed", func() {
+			var lock sync.Mutex
+			calls := make(map[string]int)
+			var failures []error
+			handled := make(chan string, testItemNum)
+
+			runner := Run[*testItem](context.Background(), queue, 3, func(ctx context.Context, item *testItem) error {
+				lock.Lock()
+				calls[item.key]++
+				n := calls[item.key]
+				lock.Unlock()
+				if item.value%2 == 1 && n == 1 {
+					panic("odd item")
+				}
+				if item.value%2 == 0 && n < 3 {
+					return errors.New("even item")
+				}
+				handled <- item.key
+				return nil
+			}, WithRetry[*testItem](limiter, 0), WithErrorHandler(func(item *testItem, err error) {
+				lock.Lock()
+				failures = append(failures, err)
+				lock.Unlock()
+			}))
+
+			for i := 0; i < testItemNum; i++ {
+				queue.Add(&testItem{key: fmt.Sprintf("Item_%d", i), value: i})
+			}
+			for i := 0; i < testItemNum; i++ {
+				<-handled
+			}
+			runner.Stop()
+			runner.Wait()
+
+			lock.Lock()
+			defer lock.Unlock()
+			convey.So(len(failures), convey.ShouldEqual, testItemNum/2+testItemNum)
+			var panicked *PanicError
+			panics := 0
+			for _, err := range failures {
+				if errors.As(err, &panicked) {
+					panics++
+				}
+			}
+			convey.So(panics, convey.ShouldEqual, testItemNum/2)
+			convey.So(limiter.NumRequeues(fmt.Sprintf("Item_%d", 0)), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test items are dropped after the maximum retries", func() {
+			var calls int32
+			runner := Run[*testItem](context.Background(), queue, 1, func(ctx context.Context, item *testItem) error {
+				atomic.AddInt32(&calls, 1)
+				return errors.New("always failing")
+			}, WithRetry[*testItem](limiter, 2))
+			queue.Add(&testItem{key: "Item_0", value: 0})
+
+			eventually(func() bool { return atomic.LoadInt32(&calls) >= 3 })
+			time.Sleep(50 * time.Millisecond)
+			runner.Stop()
+			runner.Wait()
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 3)
+			convey.So(queue.Len(), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test the item timeout cancels the handler", func() {
+			errs := make(chan error, 1)
+			runner := Run[*testItem](context.Background(), queue, 1, func(ctx context.Context, item *testItem) error {
+				<-ctx.Done()
+				errs <- ctx.Err()
+				return nil
+			}, WithItemTimeout[*testItem](10*time.Millisecond))
+			queue.Add(&testItem{key: "Item_0", value: 0})
+
+			err := <-errs
+			convey.So(err == context.DeadlineExceeded, convey.ShouldBeTrue)
+			runner.Stop()
+			runner.Wait()
+		})
+
+		convey.Convey("test stopping waits for the handlers in flight", func() {
+			started := make(chan struct{})
+			var finished int32
+			ctx, cancel := context.WithCancel(context.Background())
+			runner := Run[*testItem](ctx, queue, 2, func(ctx context.Context, item *testItem) error {
+				close(started)
+				time.Sleep(50 * time.Millisecond)
+				atomic.StoreInt32(&finished, 1)
+				return nil
+			})
+			queue.Add(&testItem{key: "Item_0", value: 0})
+
+			<-started
+			cancel()
+			runner.Wait()
+			convey.So(atomic.LoadInt32(&finished), convey.ShouldEqual, 1)
+
+			runner.Resize(4)
+			convey.So(runner.Workers(), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test resizing the workers", func() {
+			var running, peak int32
+			release := make(chan struct{})
+			runner := Run[*testItem](context.Background(), queue, 1, func(ctx context.Context, item *testItem) error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					old := atomic.LoadInt32(&peak)
+					if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+						break
+					}
+				}
+				<-release
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			runner.Resize(4)
+			convey.So(runner.Workers(), convey.ShouldEqual, 4)
+
+			for i := 0; i < testItemNum; i++ {
+				queue.Add(&testItem{key: fmt.Sprintf("Item_%d", i), value: i})
+			}
+			eventually(func() bool { return atomic.LoadInt32(&peak) == 4 })
+			convey.So(atomic.LoadInt32(&peak), convey.ShouldEqual, 4)
+
+			runner.Resize(2)
+			convey.So(runner.Workers(), convey.ShouldEqual, 2)
+			close(release)
+			eventually(func() bool { return queue.Len() == 0 })
+			convey.So(queue.Len(), convey.ShouldEqual, 0)
+
+			runner.Stop()
+			runner.Wait()
+		})
+
+		convey.Convey("test shutting down the queue stops the runner", func() {
+			runner := Run[*testItem](context.Background(), queue, 2, func(ctx context.Context, item *testItem) error {
+				return nil
+			})
+			queue.Shutdown()
+			runner.Wait()
+		})
+
+		convey.Convey("test an item added again while failing is handled once more", func() {
+			work := newLeaseQueue[*testItem](&testConstraint{}, time.Minute)
+			defer work.Shutdown()
+			var calls int32
+			runner := Run[*testItem](context.Background(), work, 1, func(ctx context.Context, item *testItem) error {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					work.Add(&testItem{key: item.key, value: 1})
+				}
+				return errors.New("failing")
+			}, WithRetry[*testItem](limiter, 1))
+			work.Add(&testItem{key: "Item_0", value: 0})
+
+			// The newer value is handled and retried, the failed one is not.
+			eventually(func() bool { return atomic.LoadInt32(&calls) >= 3 })
+			time.Sleep(50 * time.Millisecond)
+			runner.Stop()
+			runner.Wait()
+			convey.So(atomic.LoadInt32(&calls), convey.ShouldEqual, 3)
+			convey.So(work.Len(), convey.ShouldEqual, 0)
+		})
+	})
+}
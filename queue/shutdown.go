@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"sort"
+)
+
+// ShutdownWithDrain stops accepting new items and keeps serving pops until
+// the queue is empty and, for work queues, until every item in flight is
+// done. It returns once drained, or with ctx.Err() if ctx is done first; the
+// queue is stopped in both cases and the items left can still be listed.
+func (que *blockQueue[V]) ShutdownWithDrain(ctx context.Context) error {
+	que.cond.L.Lock()
+	defer que.cond.L.Unlock()
+	if que.stopped {
+		return ErrShutdown
+	}
+
+	que.stopping = true
+	que.events.shutdown()
+	que.draining = true
+	que.cond.Broadcast()
+
+	err := que.waitForLocked(ctx, que.drainedLocked)
+	que.stopped = true
+	que.closeWatchersLocked()
+	que.closeStopLocked()
+	que.cond.Broadcast()
+	return err
+}
+
+// ShutdownWithDiscard stops the queue at once: every following pop fails. The
+// discarded items are returned in priority order.
+func (que *blockQueue[V]) ShutdownWithDiscard() []V {
+	que.cond.L.Lock()
+	que.stopping = true
+	que.events.shutdown()
+	que.stopped = true
+	que.closeStopLocked()
+	items := que.heap.PopN(que.heap.Len())
+	if que.partitions != nil {
+		// The items held back by their partition are discarded as well.
+		held := que.heap.List()
+		for _, item := range held {
+			_ = que.heap.Delete(item)
+		}
+		items = append(items, held...)
+		sort.SliceStable(items, func(i, j int) bool {
+			return que.constraint.Less(items[i], items[j])
+		})
+	}
+	if que.processing != nil {
+		for key, value := range que.processing.dirty {
+			items = append(items, value)
+			delete(que.processing.dirty, key)
+		}
+	}
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	que.cond.Broadcast()
+	notify()
+	return items
+}
+
+// stop makes every following pop fail, leaving the items in the queue.
+func (que *blockQueue[V]) stop() {
+	que.cond.L.Lock()
+	que.stopping = true
+	que.events.shutdown()
+	que.stopped = true
+	que.closeWatchersLocked()
+	que.closeStopLocked()
+	que.cond.L.Unlock()
+	que.cond.Broadcast()
+}
+
+// closeStopLocked closes que.stopCh, once.
+func (que *blockQueue[V]) closeStopLocked() {
+	select {
+	case <-que.stopCh:
+	default:
+		close(que.stopCh)
+	}
+}
+
+// drainedLocked reports whether the queue has no item left to hand out and no
+// item in flight.
+func (que *blockQueue[V]) drainedLocked() bool {
+	if que.heap.Len() > 0 {
+		return false
+	}
+	return que.processing == nil || len(que.processing.inFlight) == 0
+}
+
+// ShutdownWithDrain stops accepting new items, waits for the delayed items to
+// get ready and then drains the main queue like BlockQueue.ShutdownWithDrain.
+// The queue is shut down once it returns, whether it drained or ctx is done.
+func (q *delayingQueue[V]) ShutdownWithDrain(ctx context.Context) error {
+	if q.isStopped() {
+		return ErrShutdown
+	}
+
+	q.lock.Lock()
+	q.draining = true
+	q.lock.Unlock()
+	defer q.Shutdown()
+	q.mainQueue.events.shutdown()
+
+	q.waitQueue.cond.L.Lock()
+	err := q.waitQueue.waitForLocked(ctx, func() bool {
+		return q.waitQueue.heap.Len() == 0 && q.pending == 0
+	})
+	q.waitQueue.cond.L.Unlock()
+	if err != nil {
+		q.mainQueue.stop()
+		return err
+	}
+
+	return q.mainQueue.ShutdownWithDrain(ctx)
+}
+
+// ShutdownWithDiscard shuts the queue down at once. The discarded ready items
+// are returned in priority order, followed by the delayed ones.
+func (q *delayingQueue[V]) ShutdownWithDiscard() []V {
+	q.lock.Lock()
+	q.draining = true
+	q.lock.Unlock()
+
+	items := q.mainQueue.ShutdownWithDiscard()
+	for _, item := range q.waitQueue.ShutdownWithDiscard() {
+		items = append(items, item.value)
+	}
+	q.Shutdown()
+	return items
+}
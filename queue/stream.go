@@ -0,0 +1,62 @@
+package queue
+
+import "context"
+
+// stream pops items with pop and delivers them on the returned channel, one
+// at a time and in priority order. The channel is closed once pop fails,
+// typically because the queue was shut down, once ctx is done or once stop is
+// closed. An item popped while nobody is reading is handed back to requeue
+// then, so that it is not lost.
+func stream[V any](ctx context.Context, pop func(context.Context) (V, error), requeue func(V), stop <-chan struct{}) <-chan V {
+	ch := make(chan V)
+	go func() {
+		defer close(ch)
+		for {
+			item, err := pop(ctx)
+			if err != nil {
+				return
+			}
+
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				requeue(item)
+				return
+			case <-stop:
+				requeue(item)
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Chan returns a channel delivering the items of the queue in priority order.
+// The channel is closed on Shutdown or when ctx is done; the item waiting to
+// be delivered then goes back to the queue. A drain keeps the channel open
+// until it ends.
+func (que *blockQueue[V]) Chan(ctx context.Context) <-chan V {
+	return stream[V](ctx, que.PopContext, que.requeue, que.stopCh)
+}
+
+// requeue puts back an item which was popped but not consumed, unless an item
+// with the same key was added in the meantime, in which case the newer item
+// is kept.
+func (que *blockQueue[V]) requeue(value V) {
+	que.cond.L.Lock()
+	if que.processing != nil {
+		que.releaseLocked(value, true)
+	} else if _, ok := que.heap.Get(value); !ok {
+		que.heap.Add(value)
+	}
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	que.cond.Broadcast()
+	notify()
+}
+
+// Chan returns a channel delivering the ready items of the queue in priority
+// order. The channel is closed on Shutdown or when ctx is done.
+func (q *delayingQueue[V]) Chan(ctx context.Context) <-chan V {
+	return q.mainQueue.Chan(ctx)
+}
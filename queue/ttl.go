@@ -0,0 +1,218 @@
+package queue
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+// TTLConstraint is a HeapConstraint giving every item its own time to live,
+// which overrides WithTTL when positive.
+type TTLConstraint[V any] interface {
+	HeapConstraint[V]
+	TTL(value V) time.Duration
+}
+
+// WithTTL drops the items which were not popped within ttl of being added,
+// or of getting ready for delayed items. Updating an item does not extend its
+// time to live.
+//
+// Expired items are dropped before they can be popped or counted against the
+// capacity. A DelayingQueue also drops them from its timer loop, so that
+// OnExpire is called soon after they expired.
+func WithTTL(ttl time.Duration) Option {
+	return func(cfg *options) {
+		cfg.ttl = ttl
+	}
+}
+
+// WithOnExpire calls onExpire with every item dropped once its time to live
+// elapsed. It is called without holding the queue lock.
+func WithOnExpire[V any](onExpire func(value V)) Option {
+	return func(cfg *options) {
+		cfg.onExpire = func(value any) {
+			onExpire(value.(V))
+		}
+	}
+}
+
+// ttlOf returns the time to live of the items, or nil when they never
+// expire.
+func ttlOf[V any](constraint HeapConstraint[V], cfg options) func(V) time.Duration {
+	perItem, ok := constraint.(TTLConstraint[V])
+	if !ok {
+		if cfg.ttl <= 0 {
+			return nil
+		}
+		return func(V) time.Duration {
+			return cfg.ttl
+		}
+	}
+	return func(value V) time.Duration {
+		if ttl := perItem.TTL(value); ttl > 0 {
+			return ttl
+		}
+		return cfg.ttl
+	}
+}
+
+type deadline[V any] struct {
+	key   string
+	at    time.Time
+	value V
+}
+
+type deadlineOrder[V any] struct{}
+
+func (deadlineOrder[V]) FormStoreKey(d *deadline[V]) string {
+	return d.key
+}
+
+func (deadlineOrder[V]) Less(left, right *deadline[V]) bool {
+	return left.at.Before(right.at)
+}
+
+func (h *trackedHeap[V]) withTTL(ttl func(V) time.Duration) *trackedHeap[V] {
+	if ttl != nil {
+		h.ttl = ttl
+		h.deadlines = heap.New[string, *deadline[V]](deadlineOrder[V]{})
+	}
+	return h
+}
+
+// trackDeadline sets the deadline of a new item, and keeps the value of an
+// updated one current.
+func (h *trackedHeap[V]) trackDeadline(key string, value V, added bool) {
+	if h.deadlines == nil {
+		return
+	}
+	if !added {
+		if d, ok := h.deadlines.Get(&deadline[V]{key: key}); ok {
+			d.value = value
+		}
+		return
+	}
+	if ttl := h.ttl(value); ttl > 0 {
+		h.deadlines.Add(&deadline[V]{key: key, at: time.Now().Add(ttl), value: value})
+	}
+}
+
+func (h *trackedHeap[V]) untrackDeadline(key string) {
+	if h.deadlines != nil {
+		_ = h.deadlines.Delete(&deadline[V]{key: key})
+	}
+}
+
+// notifyWaitingLocked runs the callbacks of notifyLocked before a pop goes
+// back to waiting, so that they do not wait for the pop to return. The lock
+// is released meanwhile.
+func (que *blockQueue[V]) notifyWaitingLocked() {
+	if len(que.expired) == 0 {
+		return
+	}
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	que.cond.Broadcast()
+	notify()
+	que.cond.L.Lock()
+}
+
+// nextDeadline returns when the next item expires.
+func (h *trackedHeap[V]) nextDeadline() (time.Time, bool) {
+	if h.deadlines == nil {
+		return time.Time{}, false
+	}
+	next, err := h.deadlines.Peek()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return next.at, true
+}
+
+// expire removes the items whose deadline passed and returns them.
+func (h *trackedHeap[V]) expire(now time.Time) []V {
+	if h.deadlines == nil {
+		return nil
+	}
+	var expired []V
+	for h.deadlines.Len() > 0 {
+		next, _ := h.deadlines.Peek()
+		if next.at.After(now) {
+			break
+		}
+		_ = h.deadlines.Delete(next)
+		_ = h.enqueued.Delete(&enqueued{key: next.key})
+		if err := h.Heap.Delete(next.value); err != nil {
+			continue
+		}
+		h.metrics.Expire()
+		h.emit(EventExpired, next.value)
+		expired = append(expired, next.value)
+	}
+	if len(expired) > 0 {
+		h.report()
+	}
+	return expired
+}
+
+// expireLocked drops the expired items; OnExpire is called for them by the
+// callback of notifyLocked.
+func (que *blockQueue[V]) expireLocked() {
+	que.expired = append(que.expired, que.heap.expire(time.Now())...)
+}
+
+// expire drops the expired items and returns when the next item expires.
+func (que *blockQueue[V]) expire() (time.Time, bool) {
+	que.cond.L.Lock()
+	que.expireLocked()
+	next, ok := que.heap.nextDeadline()
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	que.cond.Broadcast()
+	notify()
+	return next, ok
+}
+
+// nextDeadline returns when the next item expires, if any item does.
+func (que *blockQueue[V]) nextDeadline() (time.Time, bool) {
+	que.cond.L.Lock()
+	defer que.cond.L.Unlock()
+	return que.heap.nextDeadline()
+}
+
+// sweepSoon wakes the waiting loop up when an item of the main queue expires
+// before the loop would wake up on its own.
+func (q *delayingQueue[V]) sweepSoon() {
+	if q.mainQueue.heap.ttl == nil {
+		return
+	}
+	next, ok := q.mainQueue.nextDeadline()
+	if !ok || next.UnixNano() >= atomic.LoadInt64(&q.sweepAt) {
+		return
+	}
+	select {
+	case q.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// notifyLocked returns the callbacks to run once the lock is released: the
+// watermark callbacks and OnExpire for the items expired since the last call.
+// The watchers are done with once the queue hands out no more items.
+func (que *blockQueue[V]) notifyLocked() func() {
+	que.closeWatchersLocked()
+	watermark := que.watermarkLocked()
+	expired := que.expired
+	que.expired = nil
+	onExpire := que.opts.onExpire
+	if len(expired) == 0 || onExpire == nil {
+		return watermark
+	}
+	return func() {
+		for _, value := range expired {
+			onExpire(value)
+		}
+		watermark()
+	}
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type testTTLConstraint struct {
+	testConstraint
+}
+
+// TTL gives the items a time to live of value milliseconds.
+func (t *testTTLConstraint) TTL(item *testItem) time.Duration {
+	return time.Duration(item.value) * time.Millisecond
+}
+
+func TestBlockQueue_TTL(t *testing.T) {
+	convey.Convey("test block queue ttl", t, func() {
+		var lock sync.Mutex
+		var expired []string
+		provider := NewInMemoryMetricsProvider()
+		queue := newBlockQueue[*testItem](&testTTLConstraint{},
+			WithTTL(time.Hour),
+			WithMetrics("ttl", provider),
+			WithOnExpire(func(item *testItem) {
+				lock.Lock()
+				expired = append(expired, item.key)
+				lock.Unlock()
+			}))
+
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		queue.Add(&testItem{key: "Item_10", value: 10})
+		queue.Add(&testItem{key: "Item_60000", value: 60000})
+		// Updating an item does not extend its time to live.
+		time.Sleep(5 * time.Millisecond)
+		convey.So(queue.Update(&testItem{key: "Item_10", value: 11}), convey.ShouldBeNil)
+		time.Sleep(10 * time.Millisecond)
+
+		item, err := queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(item.key, convey.ShouldEqual, "Item_0")
+		item, err = queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(item.key, convey.ShouldEqual, "Item_60000")
+
+		lock.Lock()
+		convey.So(expired, convey.ShouldResemble, []string{"Item_10"})
+		lock.Unlock()
+		metrics, _ := provider.Get("ttl")
+		convey.So(metrics.Snapshot().Expired, convey.ShouldEqual, 1)
+		convey.So(queue.Len(), convey.ShouldEqual, 0)
+	})
+}
+
+func TestDelayingQueue_TTL(t *testing.T) {
+	convey.Convey("test delaying queue ttl", t, func() {
+		expired := make(chan *testItem, testItemNum)
+		queue := newDelayingQueue[*testItem](&testConstraint{},
+			WithTTL(20*time.Millisecond),
+			WithOnExpire(func(item *testItem) {
+				expired <- item
+			}))
+		defer queue.Shutdown()
+
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		queue.AddAfter(&testItem{key: "Item_1", value: 1}, 30*time.Millisecond)
+
+		// The timer loop drops the items without any pop.
+		item := <-expired
+		convey.So(item.key, convey.ShouldEqual, "Item_0")
+		convey.So(queue.Len(), convey.ShouldEqual, 1)
+
+		// The delayed item lives from the time it got ready, not from
+		// AddAfter.
+		item, err := queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(item.key, convey.ShouldEqual, "Item_1")
+		convey.So(len(expired), convey.ShouldEqual, 0)
+	})
+}
+
+func TestDelayingQueue_TTLSweep(t *testing.T) {
+	convey.Convey("test delaying queue sweeps an item expiring first", t, func() {
+		expired := make(chan *testItem, testItemNum)
+		queue := newDelayingQueue[*testItem](&testTTLConstraint{},
+			WithOnExpire(func(item *testItem) {
+				expired <- item
+			}))
+		defer queue.Shutdown()
+
+		queue.Add(&testItem{key: "Item_60000", value: 60000})
+		eventually(func() bool { return atomic.LoadInt64(&queue.sweepAt) != math.MaxInt64 })
+		queue.Add(&testItem{key: "Item_20", value: 20})
+
+		select {
+		case item := <-expired:
+			convey.So(item.key, convey.ShouldEqual, "Item_20")
+		case <-time.After(2 * time.Second):
+			t.Fatal("the item was not swept once expired")
+		}
+		convey.So(queue.Len(), convey.ShouldEqual, 1)
+	})
+}
+
+func TestBlockQueue_TTLWaitingPop(t *testing.T) {
+	convey.Convey("test items expired by a waiting pop are reported", t, func() {
+		expired := make(chan *testItem, testItemNum)
+		queue := newBlockQueue[*testItem](&testTTLConstraint{},
+			WithOnExpire(func(item *testItem) {
+				expired <- item
+			}))
+
+		queue.Add(&testItem{key: "Item_20", value: 20})
+		time.Sleep(30 * time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			_, _ = queue.PopContext(ctx)
+		}()
+
+		select {
+		case item := <-expired:
+			convey.So(item.key, convey.ShouldEqual, "Item_20")
+		case <-time.After(time.Second):
+			t.Fatal("OnExpire waited for the pop to return")
+		}
+	})
+}
+
+func TestDelayingQueue_TTLFullBlockingQueue(t *testing.T) {
+	convey.Convey("test a full blocking queue does not hold the timer loop up", t, func() {
+		expired := make(chan *testItem, testItemNum)
+		queue := newDelayingQueue[*testItem](&testTTLConstraint{},
+			WithCapacity(1, OverflowBlock),
+			WithOnExpire(func(item *testItem) {
+				expired <- item
+			}))
+		defer queue.Shutdown()
+
+		queue.Add(&testItem{key: "Item_100", value: 100})
+		queue.AddAfter(&testItem{key: "Item_60000", value: 60000}, time.Millisecond)
+
+		// The delayed item waits for room while the loop keeps on
+		// sweeping the expired items.
+		select {
+		case item := <-expired:
+			convey.So(item.key, convey.ShouldEqual, "Item_100")
+		case <-time.After(time.Second):
+			t.Fatal("the item was not swept once expired")
+		}
+
+		item, err := queue.PopTimeout(time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(item.key, convey.ShouldEqual, "Item_60000")
+	})
+}
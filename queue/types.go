@@ -1,6 +1,8 @@
 package queue
 
 import (
+	"context"
+	"io"
 	"time"
 
 	"github.com/LiuYuuChen/algorithms/heap"
@@ -12,7 +14,10 @@ type Queue[V any] interface {
 	Delete(value V) error
 	Get(value V) (V, bool)
 	Pop() (V, error)
+	TryPop() (V, bool)
+	PopN(n int) ([]V, error)
 	Peek() (V, error)
+	PeekN(n int) []V
 	List() []V
 	Len() int
 }
@@ -21,14 +26,68 @@ type HeapConstraint[VALUE any] interface {
 	heap.Constraint[string, VALUE]
 }
 
+// BlockQueue is a Queue whose pops wait for items.
+//
+// Once shut down, every operation modifying the queue fails with ErrShutdown;
+// Add, which can not report it, drops the item. Pops follow the shutdown mode
+// and fail with ErrShutdown once the queue is stopped. Get, List, Len, Peek,
+// PeekN and IsShutdown remain valid, and WorkQueue.Done can still be called
+// for the items in flight.
 type BlockQueue[V any] interface {
 	Queue[V]
+	AddContext(ctx context.Context, value V) error
+	TryAdd(value V) error
+	PopContext(ctx context.Context) (V, error)
+	PopTimeout(timeout time.Duration) (V, error)
+	PopBatch(max int, maxWait time.Duration) ([]V, error)
+	PopBatchContext(ctx context.Context, max int, maxWait time.Duration) ([]V, error)
+	Chan(ctx context.Context) <-chan V
+	Watch(ctx context.Context) <-chan Event[V]
 	Shutdown()
+	ShutdownWithDrain(ctx context.Context) error
+	ShutdownWithDiscard() []V
 	IsShutdown() bool
 }
 
+type WorkQueue[V any] interface {
+	BlockQueue[V]
+	Done(value V)
+}
+
 type DelayingQueue[V any] interface {
 	BlockQueue[V]
 	AddAfter(value V, duration time.Duration)
+	AddAfterContext(ctx context.Context, value V, duration time.Duration) error
 	Refresh(obj V) error
+	Dump(w io.Writer, format func(V) string) error
+}
+
+type RateLimitingQueue[V any] interface {
+	DelayingQueue[V]
+	AddRateLimited(value V)
+	Forget(value V)
+	NumRequeues(value V) int
+}
+
+type DeadLetterQueue[V any] interface {
+	RateLimitingQueue[V]
+	Retry(value V, err error) bool
+	Attempts(value V) []Attempt
+	DeadLetters() []DeadLetter[V]
+	DeadLetter(value V) (DeadLetter[V], bool)
+	Dead() BlockQueue[*DeadLetter[V]]
+	Redrive(value V) error
+	RedriveAll() int
+	Purge(value V) error
+	PurgeAll() int
+}
+
+type LeaseQueue[V any] interface {
+	DelayingQueue[V]
+	Done(value V)
+	PopLease() (Lease[V], error)
+	PopLeaseContext(ctx context.Context) (Lease[V], error)
+	Ack(lease Lease[V]) error
+	Nack(lease Lease[V], delay time.Duration) error
+	Extend(lease Lease[V], duration time.Duration) (Lease[V], error)
 }
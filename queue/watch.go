@@ -0,0 +1,261 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventType tells what happened to the item of an Event.
+type EventType int
+
+const (
+	// EventAdded is sent when an item is added to the ready items.
+	EventAdded EventType = iota
+	// EventUpdated is sent when a queued item is updated.
+	EventUpdated
+	// EventDeleted is sent when an item is deleted or evicted.
+	EventDeleted
+	// EventPopped is sent when an item is popped, or discarded by
+	// ShutdownWithDiscard.
+	EventPopped
+	// EventDelayed is sent when an item is added to the wait queue of a
+	// DelayingQueue.
+	EventDelayed
+	// EventPromoted is sent when a delayed item moves to the ready items.
+	EventPromoted
+	// EventExpired is sent when an item is dropped once its TTL elapsed.
+	EventExpired
+	// EventShutdown is sent once when the queue starts shutting down. Events
+	// of items drained afterwards may follow.
+	EventShutdown
+)
+
+var eventTypeNames = [...]string{"Added", "Updated", "Deleted", "Popped", "Delayed", "Promoted", "Expired", "Shutdown"}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventTypeNames) {
+		return "Unknown"
+	}
+	return eventTypeNames[t]
+}
+
+// Event is a change of a queue.
+type Event[V any] struct {
+	Type EventType
+	// Value is the item, the zero value for EventShutdown.
+	Value V
+	Time  time.Time
+	// ReadyAt is when a delayed item gets ready, for the events of the wait
+	// queue of a DelayingQueue.
+	ReadyAt time.Time
+}
+
+// SlowSubscriberPolicy decides what happens to the events of a watcher whose
+// buffer is full. The queue never waits for its watchers.
+type SlowSubscriberPolicy int
+
+const (
+	// WatchDisconnect closes the channel of the watcher, which can tell
+	// it missed events and watch again.
+	WatchDisconnect SlowSubscriberPolicy = iota
+	// WatchDropNewest drops the events which do not fit in the buffer.
+	WatchDropNewest
+	// WatchDropOldest drops the oldest buffered event to make room.
+	WatchDropOldest
+)
+
+// defaultWatchBuffer is the number of events buffered per watcher.
+const defaultWatchBuffer = 128
+
+// WithWatchBuffer buffers up to size events per watcher, and applies policy
+// to the watchers falling behind. It defaults to 128 events and
+// WatchDisconnect.
+func WithWatchBuffer(size int, policy SlowSubscriberPolicy) Option {
+	return func(cfg *options) {
+		cfg.watchBuffer = size
+		cfg.watchPolicy = policy
+	}
+}
+
+type watcher[V any] struct {
+	ch     chan Event[V]
+	closed bool
+}
+
+// watchers fans the events of a queue out to its watchers.
+type watchers[V any] struct {
+	lock     sync.Mutex
+	size     int
+	policy   SlowSubscriberPolicy
+	watchers map[*watcher[V]]struct{}
+	shut     bool
+	// done is closed once the queue sends no more events.
+	done chan struct{}
+}
+
+func newWatchers[V any](cfg options) *watchers[V] {
+	size := cfg.watchBuffer
+	if size <= 0 {
+		size = defaultWatchBuffer
+	}
+	return &watchers[V]{
+		size:     size,
+		policy:   cfg.watchPolicy,
+		watchers: make(map[*watcher[V]]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *watchers[V]) watch(ctx context.Context) <-chan Event[V] {
+	sub := &watcher[V]{ch: make(chan Event[V], w.size)}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	select {
+	case <-w.done:
+		close(sub.ch)
+		return sub.ch
+	default:
+	}
+	w.watchers[sub] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+			return
+		}
+		w.lock.Lock()
+		w.closeLocked(sub)
+		w.lock.Unlock()
+	}()
+	return sub.ch
+}
+
+func (w *watchers[V]) emit(t EventType, value V) {
+	w.publish(Event[V]{Type: t, Value: value, Time: time.Now()})
+}
+
+// publish hands the event to every watcher without blocking.
+func (w *watchers[V]) publish(event Event[V]) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for sub := range w.watchers {
+		select {
+		case sub.ch <- event:
+			continue
+		default:
+		}
+
+		switch w.policy {
+		case WatchDropNewest:
+		case WatchDropOldest:
+			select {
+			case <-sub.ch:
+			default:
+			}
+			select {
+			case sub.ch <- event:
+			default:
+			}
+		default:
+			w.closeLocked(sub)
+		}
+	}
+}
+
+// shutdown sends EventShutdown, once.
+func (w *watchers[V]) shutdown() {
+	w.lock.Lock()
+	shut := w.shut
+	w.shut = true
+	w.lock.Unlock()
+	if !shut {
+		w.publish(Event[V]{Type: EventShutdown, Time: time.Now()})
+	}
+}
+
+// close closes the channels of the watchers, and of the ones to come.
+func (w *watchers[V]) close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	close(w.done)
+	for sub := range w.watchers {
+		w.closeLocked(sub)
+	}
+}
+
+func (w *watchers[V]) closeLocked(sub *watcher[V]) {
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+		delete(w.watchers, sub)
+	}
+}
+
+// Watch streams the changes of the queue until ctx is done or the queue hands
+// out no more items after a shutdown, when the channel is closed. A watcher
+// falling behind is handled as set by WithWatchBuffer.
+func (que *blockQueue[V]) Watch(ctx context.Context) <-chan Event[V] {
+	return que.events.watch(ctx)
+}
+
+// closeWatchersLocked closes the channels of the watchers once the queue
+// hands out no more items: it is stopped, or it is shut down without draining
+// and holds no item, in flight or not.
+func (que *blockQueue[V]) closeWatchersLocked() {
+	if que.stopped || que.stopping && !que.draining && que.drainedLocked() {
+		que.events.close()
+	}
+}
+
+// Watch streams the changes of the ready items and of the delayed items
+// until ctx is done or the queue hands out no more items after a shutdown,
+// when the channel is closed.
+func (q *delayingQueue[V]) Watch(ctx context.Context) <-chan Event[V] {
+	return q.mainQueue.Watch(ctx)
+}
+
+// watchWaiting reports the changes of the wait queue to the watchers of the
+// main queue. Items popped from the wait queue are reported once promoted.
+func (q *delayingQueue[V]) watchWaiting() {
+	events := q.mainQueue.events
+	q.waitQueue.heap.emit = func(t EventType, item *waitFor[V]) {
+		switch t {
+		case EventAdded:
+			t = EventDelayed
+		case EventUpdated, EventDeleted:
+		default:
+			return
+		}
+		events.publish(Event[V]{Type: t, Value: item.value, Time: time.Now(), ReadyAt: item.readyAt})
+	}
+}
+
+// promote adds a delayed item which got ready. It never blocks: when the
+// queue is full under OverflowBlock, it fails with ErrFull and returns a
+// channel closed once the queue changed, to try the item again then.
+func (que *blockQueue[V]) promote(value V) (<-chan struct{}, error) {
+	key := que.constraint.FormStoreKey(value)
+	que.cond.L.Lock()
+	que.heap.promotions[key] = struct{}{}
+	err := que.addLocked(context.Background(), value, false)
+	// The item may have been deferred or rejected.
+	delete(que.heap.promotions, key)
+	var room chan struct{}
+	if err == ErrFull && que.opts.overflow == OverflowBlock {
+		room = que.cond.wait()
+	}
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	if err == nil {
+		que.cond.Broadcast()
+	}
+	notify()
+	return room, err
+}
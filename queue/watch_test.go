@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func receiveEvents(events <-chan Event[*testItem], n int) []Event[*testItem] {
+	var received []Event[*testItem]
+	timeout := time.After(time.Second)
+	for len(received) < n {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return received
+			}
+			received = append(received, event)
+		case <-timeout:
+			return received
+		}
+	}
+	return received
+}
+
+func TestBlockQueue_Watch(t *testing.T) {
+	convey.Convey("test watching a block queue", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		queue := newBlockQueue[*testItem](&testConstraint{})
+		events := queue.Watch(ctx)
+
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		queue.Add(&testItem{key: "Item_0", value: 1})
+		queue.Add(&testItem{key: "Item_1", value: 2})
+		convey.So(queue.Delete(&testItem{key: "Item_1"}), convey.ShouldBeNil)
+		_, err := queue.Pop()
+		convey.So(err, convey.ShouldBeNil)
+		queue.Shutdown()
+
+		received := receiveEvents(events, 6)
+		types := make([]EventType, 0, len(received))
+		for _, event := range received {
+			types = append(types, event.Type)
+		}
+		convey.So(types, convey.ShouldResemble, []EventType{
+			EventAdded, EventUpdated, EventAdded, EventDeleted, EventPopped, EventShutdown,
+		})
+		convey.So(received[1].Value.value, convey.ShouldEqual, 1)
+		convey.So(received[5].Type.String(), convey.ShouldEqual, "Shutdown")
+
+		cancel()
+		_, ok := <-events
+		convey.So(ok, convey.ShouldBeFalse)
+	})
+}
+
+func TestDelayingQueue_Watch(t *testing.T) {
+	convey.Convey("test watching a delaying queue", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		queue := newDelayingQueue[*testItem](&testConstraint{})
+		defer queue.Shutdown()
+		events := queue.Watch(ctx)
+
+		queue.AddAfter(&testItem{key: "Item_0", value: 0}, 10*time.Millisecond)
+		received := receiveEvents(events, 2)
+		convey.So(len(received), convey.ShouldEqual, 2)
+		convey.So(received[0].Type, convey.ShouldEqual, EventDelayed)
+		convey.So(received[0].ReadyAt.IsZero(), convey.ShouldBeFalse)
+		convey.So(received[1].Type, convey.ShouldEqual, EventPromoted)
+		convey.So(received[1].Value.key, convey.ShouldEqual, "Item_0")
+	})
+}
+
+func TestWatch_SlowSubscriber(t *testing.T) {
+	convey.Convey("test slow subscriber policies", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		convey.Convey("test slow watchers are disconnected by default", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{}, WithWatchBuffer(2, WatchDisconnect))
+			events := queue.Watch(ctx)
+			for i := 0; i < 3; i++ {
+				queue.Add(&testItem{key: "Item_0", value: i})
+			}
+			convey.So(len(receiveEvents(events, 3)), convey.ShouldEqual, 2)
+			_, ok := <-events
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("test dropping the newest events", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{}, WithWatchBuffer(2, WatchDropNewest))
+			events := queue.Watch(ctx)
+			for i := 0; i < 3; i++ {
+				queue.Add(&testItem{key: "Item_0", value: i})
+			}
+			received := receiveEvents(events, 2)
+			convey.So(received[0].Value.value, convey.ShouldEqual, 0)
+			convey.So(received[1].Value.value, convey.ShouldEqual, 1)
+			convey.So(len(events), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("test dropping the oldest events", func() {
+			queue := newBlockQueue[*testItem](&testConstraint{}, WithWatchBuffer(2, WatchDropOldest))
+			events := queue.Watch(ctx)
+			for i := 0; i < 3; i++ {
+				queue.Add(&testItem{key: "Item_0", value: i})
+			}
+			received := receiveEvents(events, 2)
+			convey.So(received[0].Value.value, convey.ShouldEqual, 1)
+			convey.So(received[1].Value.value, convey.ShouldEqual, 2)
+		})
+	})
+}
+
+func TestWatch_Shutdown(t *testing.T) {
+	convey.Convey("test watching a queue across its shutdown", t, func() {
+		queue := newBlockQueue[*testItem](&testConstraint{})
+		events := queue.Watch(context.Background())
+		received := make(chan []EventType)
+		go func() {
+			var types []EventType
+			for event := range events {
+				types = append(types, event.Type)
+			}
+			received <- types
+		}()
+
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		queue.Shutdown()
+		_, err := queue.Pop()
+		convey.So(err, convey.ShouldBeNil)
+
+		select {
+		case types := <-received:
+			convey.So(types, convey.ShouldResemble, []EventType{EventAdded, EventShutdown, EventPopped})
+		case <-time.After(time.Second):
+			t.Fatal("channel is not closed after shutdown")
+		}
+
+		_, ok := <-queue.Watch(context.Background())
+		convey.So(ok, convey.ShouldBeFalse)
+	})
+}
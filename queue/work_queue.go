@@ -0,0 +1,101 @@
+package queue
+
+// processing tracks the items handed out by a work queue. An item is in
+// flight from the moment it is popped until Done is called for it; adding
+// it again in the meantime only marks it dirty, and Done requeues it.
+type processing[V any] struct {
+	inFlight map[string]struct{}
+	dirty    map[string]V
+}
+
+func newProcessing[V any]() *processing[V] {
+	return &processing[V]{
+		inFlight: make(map[string]struct{}),
+		dirty:    make(map[string]V),
+	}
+}
+
+// NewWorkQueue returns a BlockQueue which never hands out the same key to two
+// consumers at once, like the Kubernetes workqueue.
+func NewWorkQueue[V any](constraint HeapConstraint[V], opts ...Option) WorkQueue[V] {
+	return newWorkQueue[V](constraint, opts...)
+}
+
+func newWorkQueue[V any](constraint HeapConstraint[V], opts ...Option) *blockQueue[V] {
+	que := newBlockQueue[V](constraint, opts...)
+	que.processing = newProcessing[V]()
+	return que
+}
+
+// deferLocked keeps value aside when its key is in flight. It reports whether
+// the value was deferred.
+func (que *blockQueue[V]) deferLocked(value V) bool {
+	if que.processing == nil {
+		return false
+	}
+	key := que.constraint.FormStoreKey(value)
+	if _, ok := que.processing.inFlight[key]; !ok {
+		return false
+	}
+	que.processing.dirty[key] = value
+	return true
+}
+
+// takeLocked marks popped items as in flight.
+func (que *blockQueue[V]) takeLocked(items ...V) {
+	if que.processing == nil {
+		return
+	}
+	for _, item := range items {
+		que.processing.inFlight[que.constraint.FormStoreKey(item)] = struct{}{}
+	}
+}
+
+// releaseLocked ends the processing of value. A value added while it was in
+// flight goes back to the queue, otherwise value is put back when requeue is
+// set. It reports whether a newer value was requeued.
+func (que *blockQueue[V]) releaseLocked(value V, requeue bool) bool {
+	key := que.constraint.FormStoreKey(value)
+	if _, ok := que.processing.inFlight[key]; ok {
+		delete(que.processing.inFlight, key)
+		// Only the item in flight frees its partition, a stray or a
+		// repeated Done must not let a second item of it through.
+		if que.partitions != nil {
+			que.partitions.release(value)
+		}
+	}
+	if dirty, ok := que.processing.dirty[key]; ok {
+		delete(que.processing.dirty, key)
+		que.heap.Add(dirty)
+		return true
+	}
+	if requeue {
+		que.heap.Add(value)
+	}
+	return false
+}
+
+// Done marks the processing of value as finished. If the item was added
+// again while in flight, it goes back to the queue.
+func (que *blockQueue[V]) Done(value V) {
+	que.done(value)
+}
+
+// done is Done, reporting whether the item was added again while in flight
+// and went back to the queue.
+func (que *blockQueue[V]) done(value V) bool {
+	return que.release(value, false)
+}
+
+func (que *blockQueue[V]) release(value V, requeue bool) bool {
+	if que.processing == nil {
+		return false
+	}
+	que.cond.L.Lock()
+	dirty := que.releaseLocked(value, requeue)
+	notify := que.notifyLocked()
+	que.cond.L.Unlock()
+	que.cond.Broadcast()
+	notify()
+	return dirty
+}
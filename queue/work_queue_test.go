@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestWorkQueue_Processing(t *testing.T) {
+	queue := newWorkQueue[*testItem](&testConstraint{})
+
+	convey.Convey("test work queue processing semantics", t, func() {
+		queue.Add(&testItem{key: "Item_0", value: 0})
+		queue.Add(&testItem{key: "Item_1", value: 1})
+
+		item, err := queue.Pop()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(item.key, convey.ShouldEqual, "Item_0")
+
+		convey.Convey("test re-add while in flight is deferred", func() {
+			queue.Add(&testItem{key: "Item_0", value: 5})
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+			_, ok := queue.Get(&testItem{key: "Item_0"})
+			convey.So(ok, convey.ShouldBeFalse)
+
+			// The deferred item can still be updated.
+			err := queue.Update(&testItem{key: "Item_0", value: 6})
+			convey.So(err, convey.ShouldBeNil)
+
+			queue.Done(item)
+			convey.So(queue.Len(), convey.ShouldEqual, 2)
+			requeued, ok := queue.Get(&testItem{key: "Item_0"})
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(requeued.value, convey.ShouldEqual, 6)
+		})
+
+		convey.Convey("test done without re-add", func() {
+			queue.Done(item)
+			convey.So(queue.Len(), convey.ShouldEqual, 1)
+
+			queue.Add(&testItem{key: "Item_0", value: 0})
+			convey.So(queue.Len(), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("test the same key is never popped twice concurrently", func() {
+			queue.Add(&testItem{key: "Item_0", value: 0})
+			next, ok := queue.TryPop()
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(next.key, convey.ShouldEqual, "Item_1")
+			_, ok = queue.TryPop()
+			convey.So(ok, convey.ShouldBeFalse)
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				queue.Done(item)
+			}()
+			again, err := queue.PopTimeout(time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(again.key, convey.ShouldEqual, "Item_0")
+			queue.Done(again)
+			queue.Done(next)
+		})
+
+		convey.Convey("test delete a deferred item", func() {
+			queue.Add(&testItem{key: "Item_0", value: 5})
+			convey.So(queue.Delete(&testItem{key: "Item_0"}), convey.ShouldBeNil)
+			queue.Done(item)
+			_, ok := queue.Get(&testItem{key: "Item_0"})
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		// Reset for the next leaf.
+		for queue.Len() > 0 {
+			popped, _ := queue.Pop()
+			queue.Done(popped)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+// Package reservoir samples k items from a stream of unknown length with a
+// probability proportional to their weight, following the A-Res and A-ExpJ
+// algorithms of Efraimidis and Spirakis.
+//
+// Every item gets the random key u^(1/w) and the reservoir keeps the k items
+// with the largest keys in a bounded min-heap. Keys are kept as logarithms,
+// log(u)/w, to stay precise for large weights.
+package reservoir
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/LiuYuuChen/algorithms/heap"
+)
+
+type Algorithm int
+
+const (
+	// ARes draws a random key for every observed item.
+	ARes Algorithm = iota
+	// AExpJ draws an exponential jump over the total weight of the items
+	// which can be skipped, so fewer random numbers are needed once the
+	// reservoir is full.
+	AExpJ
+)
+
+type Config struct {
+	Algorithm Algorithm
+	// Source is used to draw the random keys. A nil Source is seeded with
+	// the current time; pass a seeded source for deterministic samples.
+	Source rand.Source
+}
+
+type entry[T any] struct {
+	id     uint64
+	key    float64
+	weight float64
+	item   T
+}
+
+type keyOrder[T any] struct{}
+
+func (keyOrder[T]) FormStoreKey(e *entry[T]) uint64 {
+	return e.id
+}
+
+func (keyOrder[T]) Less(left, right *entry[T]) bool {
+	return left.key < right.key
+}
+
+// Sampler keeps a weighted sample of the observed items. It is not safe for
+// concurrent use; shard the stream and Merge the samplers instead.
+type Sampler[T any] struct {
+	k         int
+	algorithm Algorithm
+	random    *rand.Rand
+	entries   heap.Heap[*entry[T]]
+	nextID    uint64
+	// skip is the weight left to jump over before the next replacement
+	// when the A-ExpJ algorithm is used.
+	skip float64
+}
+
+func New[T any](k int, cfg Config) *Sampler[T] {
+	source := cfg.Source
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+	return &Sampler[T]{
+		k:         k,
+		algorithm: cfg.Algorithm,
+		random:    rand.New(source),
+		entries:   heap.New[uint64, *entry[T]](keyOrder[T]{}),
+	}
+}
+
+// Observe offers an item of the stream to the sampler. The weight must be a
+// positive finite number.
+func (s *Sampler[T]) Observe(item T, weight float64) error {
+	if !(weight > 0) || math.IsInf(weight, 1) {
+		return fmt.Errorf("invalid weight %v", weight)
+	}
+	if s.k <= 0 {
+		return nil
+	}
+
+	if s.entries.Len() < s.k || s.algorithm != AExpJ {
+		s.offer(&entry[T]{key: s.logKey(weight), weight: weight, item: item})
+		return nil
+	}
+
+	s.skip -= weight
+	if s.skip > 0 {
+		return nil
+	}
+
+	// The item replaces the minimum, its key is drawn conditioned on being
+	// larger than the current threshold.
+	threshold := s.threshold()
+	t := math.Exp(weight * threshold)
+	u := t + (1-t)*s.random.Float64()
+	key := math.Log(u) / weight
+	if key < threshold {
+		key = threshold
+	}
+	_, _ = s.entries.Pop()
+	s.push(&entry[T]{key: key, weight: weight, item: item})
+	s.jump()
+	return nil
+}
+
+// Merge adds the sample of another sampler, typically built over another
+// shard of the stream. The result is a sample of the union of both streams.
+func (s *Sampler[T]) Merge(other *Sampler[T]) {
+	if s.k <= 0 {
+		return
+	}
+	for _, e := range other.entries.List() {
+		s.offer(&entry[T]{key: e.key, weight: e.weight, item: e.item})
+	}
+}
+
+// Sample returns the sampled items, the item with the largest key first.
+func (s *Sampler[T]) Sample() []T {
+	entries := s.entries.PeekN(s.entries.Len())
+	items := make([]T, len(entries))
+	for i, e := range entries {
+		items[len(entries)-1-i] = e.item
+	}
+	return items
+}
+
+// Len returns the number of sampled items, at most k.
+func (s *Sampler[T]) Len() int {
+	return s.entries.Len()
+}
+
+// offer keeps the entry if the reservoir is not full or if its key is larger
+// than the smallest one.
+func (s *Sampler[T]) offer(e *entry[T]) {
+	if s.entries.Len() < s.k {
+		s.push(e)
+		if s.entries.Len() == s.k && s.algorithm == AExpJ {
+			s.jump()
+		}
+		return
+	}
+
+	if e.key <= s.threshold() {
+		return
+	}
+	_, _ = s.entries.Pop()
+	s.push(e)
+	if s.algorithm == AExpJ {
+		s.jump()
+	}
+}
+
+func (s *Sampler[T]) push(e *entry[T]) {
+	e.id = s.nextID
+	s.nextID++
+	s.entries.Add(e)
+}
+
+// threshold returns the smallest key of the reservoir.
+func (s *Sampler[T]) threshold() float64 {
+	head, err := s.entries.Peek()
+	if err != nil {
+		return math.Inf(-1)
+	}
+	return head.key
+}
+
+// jump draws the weight to skip before the next replacement.
+func (s *Sampler[T]) jump() {
+	s.skip = math.Log(s.uniform()) / s.threshold()
+}
+
+func (s *Sampler[T]) logKey(weight float64) float64 {
+	return math.Log(s.uniform()) / weight
+}
+
+// uniform returns a random number in (0, 1].
+func (s *Sampler[T]) uniform() float64 {
+	return 1 - s.random.Float64()
+}
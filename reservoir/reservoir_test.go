@@ -0,0 +1,92 @@
+package reservoir
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSampler_Deterministic(t *testing.T) {
+	for _, algorithm := range []Algorithm{ARes, AExpJ} {
+		samples := make([][]int, 2)
+		for i := range samples {
+			s := New[int](10, Config{Algorithm: algorithm, Source: rand.NewSource(42)})
+			for item := 0; item < 1000; item++ {
+				if err := s.Observe(item, float64(item%10+1)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if s.Len() != 10 {
+				t.Fatalf("expected 10 sampled items, got %d", s.Len())
+			}
+			samples[i] = s.Sample()
+		}
+		if !reflect.DeepEqual(samples[0], samples[1]) {
+			t.Fatalf("expected the same sample for the same seed, got %v and %v", samples[0], samples[1])
+		}
+	}
+}
+
+func TestSampler_Distribution(t *testing.T) {
+	const trials = 20000
+	weights := []float64{1, 2, 3, 4}
+	for _, algorithm := range []Algorithm{ARes, AExpJ} {
+		source := rand.NewSource(7)
+		counts := make([]int, len(weights))
+		for i := 0; i < trials; i++ {
+			s := New[int](1, Config{Algorithm: algorithm, Source: source})
+			for item, weight := range weights {
+				_ = s.Observe(item, weight)
+			}
+			counts[s.Sample()[0]]++
+		}
+
+		for item, weight := range weights {
+			expected := weight / 10
+			actual := float64(counts[item]) / trials
+			if math.Abs(expected-actual) > 0.02 {
+				t.Errorf("algorithm %d: expected item %d in %.2f of the samples, got %.3f", algorithm, item, expected, actual)
+			}
+		}
+	}
+}
+
+func TestSampler_Merge(t *testing.T) {
+	source := rand.NewSource(3)
+	shards := []*Sampler[int]{
+		New[int](5, Config{Source: source}),
+		New[int](5, Config{Algorithm: AExpJ, Source: source}),
+	}
+	for item := 0; item < 200; item++ {
+		weight := 1.0
+		if item == 150 {
+			weight = 1e12
+		}
+		_ = shards[item%2].Observe(item, weight)
+	}
+
+	merged := New[int](5, Config{Source: source})
+	for _, shard := range shards {
+		merged.Merge(shard)
+	}
+	sample := merged.Sample()
+	if len(sample) != 5 {
+		t.Fatalf("expected 5 sampled items, got %d", len(sample))
+	}
+	if sample[0] != 150 {
+		t.Fatalf("expected the heavy item first, got %v", sample)
+	}
+}
+
+func TestSampler_InvalidWeight(t *testing.T) {
+	s := New[int](1, Config{})
+	for _, weight := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if err := s.Observe(1, weight); err == nil {
+			t.Errorf("expected an error for weight %v", weight)
+		}
+	}
+	if s.Len() != 0 {
+		t.Fatalf("expected an empty sample")
+	}
+}